@@ -0,0 +1,156 @@
+// Package codegen produces short codes for new links. Each strategy
+// implements Generator; stores retry with a fresh code when one collides
+// with an existing link.
+package codegen
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type Generator interface {
+	Generate(ctx context.Context) (string, error)
+}
+
+// Sequence hands out increasing numbers that are never reused, backing the
+// sequential and hashid strategies.
+type Sequence interface {
+	NextSequence(ctx context.Context) (uint64, error)
+}
+
+const (
+	// Base62 is every ASCII letter and digit, so codes need no escaping.
+	Base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// Unambiguous leaves out characters that are easily misread when a
+	// code is copied by hand: 0/O/o, 1/l/I and similar.
+	Unambiguous = "23456789abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// Random picks each character of the code independently and uniformly.
+type Random struct {
+	alphabet string
+	length   int
+}
+
+func NewRandom(alphabet string, length int) (*Random, error) {
+	if len(alphabet) < 2 {
+		return nil, errors.New("alphabet must have at least 2 characters")
+	}
+	if length < 1 {
+		return nil, errors.New("length must be positive")
+	}
+
+	return &Random{alphabet: alphabet, length: length}, nil
+}
+
+func (g *Random) Generate(_ context.Context) (string, error) {
+	max := big.NewInt(int64(len(g.alphabet)))
+
+	var b strings.Builder
+	b.Grow(g.length)
+	for i := 0; i < g.length; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(g.alphabet[n.Int64()])
+	}
+
+	return b.String(), nil
+}
+
+// Sequential encodes the next number of a sequence in base62, giving the
+// shortest possible codes at the cost of making them guessable.
+type Sequential struct {
+	seq Sequence
+}
+
+func NewSequential(seq Sequence) *Sequential {
+	return &Sequential{seq: seq}
+}
+
+func (g *Sequential) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.NextSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return encode(n, Base62, 0), nil
+}
+
+// encode writes n in the given alphabet, most significant digit first,
+// left-padded with the alphabet's zero digit to at least minLength.
+func encode(n uint64, alphabet string, minLength int) string {
+	base := uint64(len(alphabet))
+
+	var digits []byte
+	for {
+		digits = append(digits, alphabet[n%base])
+		n /= base
+		if n == 0 {
+			break
+		}
+	}
+	for len(digits) < minLength {
+		digits = append(digits, alphabet[0])
+	}
+
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+func decode(code, alphabet string) (uint64, error) {
+	base := uint64(len(alphabet))
+
+	var n uint64
+	for i := 0; i < len(code); i++ {
+		digit := strings.IndexByte(alphabet, code[i])
+		if digit < 0 {
+			return 0, fmt.Errorf("invalid character %q", code[i])
+		}
+		n = n*base + uint64(digit)
+	}
+
+	return n, nil
+}
+
+// Styles lists the strategy names accepted by New.
+var Styles = []string{"random", "sequential", "hashid", "words"}
+
+// Config selects and tunes a strategy for New.
+type Config struct {
+	Style    string
+	Alphabet string // random
+	Length   int    // random, and the minimum length of hashid
+	Salt     string // hashid
+	Words    int    // words
+}
+
+// New builds the generator for cfg.Style. seq is only used by the
+// sequential and hashid styles.
+func New(cfg Config, seq Sequence) (Generator, error) {
+	switch cfg.Style {
+	case "random":
+		return NewRandom(cfg.Alphabet, cfg.Length)
+	case "sequential":
+		if seq == nil {
+			return nil, errors.New("the sequential style needs a store that provides sequences")
+		}
+		return NewSequential(seq), nil
+	case "hashid":
+		if seq == nil {
+			return nil, errors.New("the hashid style needs a store that provides sequences")
+		}
+		return NewHashID(seq, cfg.Salt, cfg.Length), nil
+	case "words":
+		return NewWords(DefaultWords, cfg.Words, "-")
+	}
+
+	return nil, fmt.Errorf("unknown code style %q: must be one of %s", cfg.Style, strings.Join(Styles, ", "))
+}
@@ -0,0 +1,125 @@
+package codegen
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type counter struct {
+	n uint64
+}
+
+func (c *counter) NextSequence(_ context.Context) (uint64, error) {
+	c.n++
+	return c.n, nil
+}
+
+func TestRandom(t *testing.T) {
+	generator, err := NewRandom(Unambiguous, 10)
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		code, err := generator.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		if len(code) != 10 {
+			t.Errorf("Expected 10 characters, got %q", code)
+		}
+		for _, c := range code {
+			if !strings.ContainsRune(Unambiguous, c) {
+				t.Errorf("Unexpected character %q in %q", c, code)
+			}
+		}
+	}
+
+	if _, err := NewRandom("a", 8); err == nil {
+		t.Error("Expected an error for a one-character alphabet")
+	}
+}
+
+func TestSequential(t *testing.T) {
+	generator := NewSequential(&counter{n: 59})
+
+	var codes []string
+	for i := 0; i < 3; i++ {
+		code, err := generator.Generate(context.Background())
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		codes = append(codes, code)
+	}
+
+	if want := []string{"Y", "Z", "10"}; strings.Join(codes, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, codes)
+	}
+}
+
+func TestHashID(t *testing.T) {
+	generator := NewHashID(&counter{}, "pepper", 8)
+
+	seen := make(map[string]bool)
+	for n := uint64(1); n <= 10000; n++ {
+		code, err := generator.Encode(n)
+		if err != nil {
+			t.Fatalf("Failed to encode %d: %v", n, err)
+		}
+		if len(code) < 8 {
+			t.Errorf("Expected at least 8 characters, got %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("Code %q issued twice", code)
+		}
+		seen[code] = true
+
+		decoded, err := generator.Decode(code)
+		if err != nil || decoded != n {
+			t.Fatalf("Decode(%q): expected %d, got %d (%v)", code, n, decoded, err)
+		}
+	}
+
+	// A different salt gives unrelated codes
+	a, _ := generator.Encode(1)
+	b, _ := NewHashID(&counter{}, "salt", 8).Encode(1)
+	if a == b {
+		t.Errorf("Expected different codes for different salts, both got %q", a)
+	}
+
+	if _, err := generator.Encode(1 << 48); err == nil {
+		t.Error("Expected an error for an out-of-range number")
+	}
+}
+
+func TestWords(t *testing.T) {
+	generator, err := NewWords(DefaultWords, 3, "-")
+	if err != nil {
+		t.Fatalf("Failed to create generator: %v", err)
+	}
+
+	code, err := generator.Generate(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if parts := strings.Split(code, "-"); len(parts) != 3 {
+		t.Errorf("Expected 3 words, got %q", code)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, style := range Styles {
+		cfg := Config{Style: style, Alphabet: Base62, Length: 8, Salt: "salt", Words: 3}
+		if _, err := New(cfg, &counter{}); err != nil {
+			t.Errorf("New(%q): %v", style, err)
+		}
+	}
+
+	if _, err := New(Config{Style: "sequential"}, nil); err == nil {
+		t.Error("Expected an error for sequential codes without a sequence")
+	}
+	if _, err := New(Config{Style: "emoji"}, nil); err == nil {
+		t.Error("Expected an error for an unknown style")
+	}
+}
@@ -0,0 +1,109 @@
+package codegen
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	hashIDBits   = 48
+	hashIDRounds = 4
+	halfMask     = 1<<(hashIDBits/2) - 1
+)
+
+// HashID obfuscates sequence numbers in the style of Hashids: codes stay
+// short and unique, but consecutive links do not get consecutive codes and
+// the count of links is not revealed. The salt keys both a permutation of
+// the number space and a shuffle of the alphabet, so deployments with
+// different salts produce unrelated codes. It is obfuscation, not
+// encryption; the salt should still be kept private.
+type HashID struct {
+	seq       Sequence
+	key       []byte
+	alphabet  string
+	minLength int
+}
+
+func NewHashID(seq Sequence, salt string, minLength int) *HashID {
+	return &HashID{
+		seq:       seq,
+		key:       []byte(salt),
+		alphabet:  shuffle(Base62, salt),
+		minLength: minLength,
+	}
+}
+
+func (g *HashID) Generate(ctx context.Context) (string, error) {
+	n, err := g.seq.NextSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return g.Encode(n)
+}
+
+// Encode returns the code for n, which must be below 2^48.
+func (g *HashID) Encode(n uint64) (string, error) {
+	if n >= 1<<hashIDBits {
+		return "", fmt.Errorf("sequence number %d is out of range", n)
+	}
+
+	return encode(g.permute(n), g.alphabet, g.minLength), nil
+}
+
+// Decode returns the sequence number a code was generated from.
+func (g *HashID) Decode(code string) (uint64, error) {
+	x, err := decode(code, g.alphabet)
+	if err != nil {
+		return 0, err
+	}
+	if x >= 1<<hashIDBits {
+		return 0, errors.New("code is out of range")
+	}
+
+	return g.unpermute(x), nil
+}
+
+// permute is a small Feistel network over 48-bit numbers, so it is a
+// bijection: distinct sequence numbers always give distinct codes.
+func (g *HashID) permute(n uint64) uint64 {
+	left, right := n>>(hashIDBits/2), n&halfMask
+	for round := 0; round < hashIDRounds; round++ {
+		left, right = right, left^g.round(round, right)
+	}
+	return left<<(hashIDBits/2) | right
+}
+
+func (g *HashID) unpermute(x uint64) uint64 {
+	left, right := x>>(hashIDBits/2), x&halfMask
+	for round := hashIDRounds - 1; round >= 0; round-- {
+		left, right = right^g.round(round, left), left
+	}
+	return left<<(hashIDBits/2) | right
+}
+
+func (g *HashID) round(round int, half uint64) uint64 {
+	mac := hmac.New(sha256.New, g.key)
+	mac.Write([]byte{byte(round), byte(half >> 16), byte(half >> 8), byte(half)})
+	sum := mac.Sum(nil)
+	return (uint64(sum[0])<<16 | uint64(sum[1])<<8 | uint64(sum[2])) & halfMask
+}
+
+// shuffle reorders alphabet deterministically from salt, as Hashids does.
+func shuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	chars := []byte(alphabet)
+	for i, v, p := len(chars)-1, 0, 0; i > 0; i, v = i-1, v+1 {
+		v %= len(salt)
+		p += int(salt[v])
+		j := (int(salt[v]) + v + p) % i
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return string(chars)
+}
@@ -0,0 +1,64 @@
+package codegen
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// DefaultWords are short, common and unambiguous English words, chosen to
+// be easy to say aloud and type. Three of them give about 21 bits.
+var DefaultWords = []string{
+	"acorn", "amber", "anchor", "apple", "arrow", "aspen", "atlas", "autumn",
+	"badge", "bamboo", "banjo", "basil", "beacon", "berry", "birch", "bison",
+	"blossom", "breeze", "brook", "cactus", "camel", "candle", "canyon", "cedar",
+	"cherry", "cider", "cinder", "clover", "cobalt", "comet", "coral", "cotton",
+	"crane", "crystal", "daisy", "dawn", "delta", "desert", "dolphin", "dune",
+	"eagle", "ember", "falcon", "fern", "fiddle", "flint", "forest", "fossil",
+	"fox", "frost", "garnet", "ginger", "glacier", "granite", "harbor", "hazel",
+	"heron", "honey", "island", "ivory", "jade", "jasmine", "juniper", "kettle",
+	"kiwi", "lagoon", "lantern", "lemon", "lilac", "linen", "lotus", "maple",
+	"marble", "meadow", "melon", "mint", "mango", "moss", "nectar", "nutmeg",
+	"oasis", "ocean", "olive", "onyx", "orchid", "otter", "panda", "parrot",
+	"pebble", "pepper", "pine", "planet", "plum", "poppy", "prairie", "quartz",
+	"quill", "rabbit", "raven", "reef", "ripple", "river", "robin", "saffron",
+	"sage", "salmon", "sequoia", "shadow", "silver", "sparrow", "spruce", "storm",
+	"summit", "sunset", "thistle", "thunder", "tiger", "timber", "topaz", "tulip",
+	"tundra", "velvet", "violet", "walnut", "willow", "winter", "zebra", "zephyr",
+}
+
+// Words joins randomly chosen words into a memorable code such as
+// "otter-maple-comet".
+type Words struct {
+	words     []string
+	count     int
+	separator string
+}
+
+func NewWords(words []string, count int, separator string) (*Words, error) {
+	if len(words) < 2 {
+		return nil, errors.New("word list must have at least 2 words")
+	}
+	if count < 1 {
+		return nil, errors.New("word count must be positive")
+	}
+
+	return &Words{words: words, count: count, separator: separator}, nil
+}
+
+func (g *Words) Generate(_ context.Context) (string, error) {
+	max := big.NewInt(int64(len(g.words)))
+
+	parts := make([]string, g.count)
+	for i := range parts {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		parts[i] = g.words[n.Int64()]
+	}
+
+	return strings.Join(parts, g.separator), nil
+}
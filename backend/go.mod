@@ -5,4 +5,11 @@ go 1.21
 require (
 	github.com/google/uuid v1.6.0
 	github.com/lib/pq v1.10.9
+	go.etcd.io/bbolt v1.3.10
+	golang.org/x/net v0.35.0
+)
+
+require (
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
 )
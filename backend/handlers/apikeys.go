@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+const maxAPIKeyNameLength = 100
+
+type CreateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateAPIKeyResponse includes the plaintext token, which is only ever
+// returned once, when the key is created.
+type CreateAPIKeyResponse struct {
+	store.APIKey
+	Key string `json:"key"`
+}
+
+// APIKeysHandler lists the caller's API keys or creates a new one.
+func (h *URLHandler) APIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if h.apiKeys == nil {
+		sendJSONError(w, "API keys are not enabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.listAPIKeys(w, r)
+	case http.MethodPost:
+		h.createAPIKey(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *URLHandler) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.apiKeys.ListAPIKeys(userID)
+	if err != nil {
+		sendJSONError(w, "Failed to get API keys", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, keys, http.StatusOK)
+}
+
+func (h *URLHandler) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		req.Name = "API key created " + time.Now().UTC().Format("2006-01-02")
+	}
+	if len(req.Name) > maxAPIKeyNameLength {
+		sendJSONError(w, "Name must be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	key, token, err := store.NewAPIKey(userID, req.Name)
+	if err != nil {
+		sendJSONError(w, "Failed to generate API key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.apiKeys.CreateAPIKey(key); err != nil {
+		sendJSONError(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, CreateAPIKeyResponse{APIKey: key, Key: token}, http.StatusCreated)
+}
+
+// RevokeAPIKeyHandler serves DELETE /api/keys/{id}.
+func (h *URLHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.apiKeys == nil {
+		sendJSONError(w, "API keys are not enabled", http.StatusNotFound)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/keys/")
+	if id == "" || strings.Contains(id, "/") {
+		sendJSONError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	switch err := h.apiKeys.RevokeAPIKey(id, userID); err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case store.ErrAPIKeyNotFound, store.ErrNotOwner:
+		sendJSONError(w, "API key not found", http.StatusNotFound)
+	default:
+		sendJSONError(w, "Failed to revoke API key", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+func TestAPIKeyAuthentication(t *testing.T) {
+	urlStore := store.NewInMemoryURLStore()
+	handler := NewURLHandler(urlStore, "http://short.test")
+	handler.SetAPIKeyStore(urlStore)
+
+	// A browser user creates a key
+	req := httptest.NewRequest(http.MethodPost, "/api/keys", strings.NewReader(`{"name":"ci"}`))
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "browser-user"})
+	rec := httptest.NewRecorder()
+	handler.APIKeysHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating key, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var created CreateAPIKeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Errorf("Expected key %q to start with prefix %q", created.Key, created.Prefix)
+	}
+
+	// A script shortens a URL with the key and no cookie
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	rec = httptest.NewRecorder()
+	handler.ShortenHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 shortening with key, got %d: %s", rec.Code, rec.Body)
+	}
+	if cookies := rec.Result().Cookies(); len(cookies) != 0 {
+		t.Errorf("Expected no cookie for API key requests, got %v", cookies)
+	}
+
+	// The link belongs to the browser user
+	entries, err := urlStore.GetByUser(context.Background(), "browser-user")
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 URL for key owner, got %v (%v)", entries, err)
+	}
+
+	// Invalid keys are rejected rather than falling back to a cookie
+	req = httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+	req.Header.Set("Authorization", "Bearer us_invalid")
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "browser-user"})
+	rec = httptest.NewRecorder()
+	handler.GetUserURLsHandler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for invalid key, got %d", rec.Code)
+	}
+
+	// Revoked keys stop working
+	req = httptest.NewRequest(http.MethodDelete, "/api/keys/"+created.ID, nil)
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "browser-user"})
+	rec = httptest.NewRecorder()
+	handler.RevokeAPIKeyHandler(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204 revoking key, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+	req.Header.Set("Authorization", "Bearer "+created.Key)
+	rec = httptest.NewRecorder()
+	handler.GetUserURLsHandler(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for revoked key, got %d", rec.Code)
+	}
+}
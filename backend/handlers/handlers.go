@@ -3,40 +3,81 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/priyankeshh/url-shortener/backend/codegen"
 	"github.com/priyankeshh/url-shortener/backend/store"
+	"github.com/priyankeshh/url-shortener/backend/urlnorm"
 	"github.com/priyankeshh/url-shortener/backend/workers"
 )
 
 type URLHandler struct {
-	store        store.URLStore
-	host         string
-	urlProcessor *workers.URLProcessor
+	store          store.URLStore
+	host           string
+	urlProcessor   *workers.URLProcessor
+	clickStore     store.ClickStore
+	clickWriter    *workers.ClickWriter
+	checkStore     store.CheckStore
+	ipHashKey      []byte
+	trustedProxies TrustedProxies
+	apiKeys        store.APIKeyStore
+	notFoundPage   []byte
+	generators     map[string]codegen.Generator
+	codeStyle      string
+	dedupe         bool
+	urlPolicy      urlnorm.Policy
 }
 
 type ShortenRequest struct {
-	URL   string `json:"url"`
-	Alias string `json:"alias,omitempty"`
+	URL       string     `json:"url"`
+	Alias     string     `json:"alias,omitempty"`
+	ExpiresIn int64      `json:"expires_in,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	MaxClicks int        `json:"max_clicks,omitempty"`
+	CodeStyle string     `json:"code_style,omitempty"`
 }
 
 type ShortenResponse struct {
-	Code string `json:"code"`
-	URL  string `json:"url,omitempty"`
+	Code       string     `json:"code"`
+	URL        string     `json:"url,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	ClicksLeft *int       `json:"clicks_remaining,omitempty"`
+	// Existing is set when dedupe mode returned a link the user already had.
+	Existing bool `json:"existing,omitempty"`
+}
+
+type UpdateURLRequest struct {
+	URL string `json:"url"`
+}
+
+type UserURL struct {
+	Code        string     `json:"code"`
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	ClicksLeft  *int       `json:"clicks_remaining,omitempty"`
+	// Metadata is the result of the last check of the destination.
+	Metadata *store.LinkMetadata `json:"metadata,omitempty"`
 }
 
 type ErrorResponse struct {
 	Error string `json:"error"`
+	// Reason identifies why a submitted URL was rejected.
+	Reason urlnorm.Reason `json:"reason,omitempty"`
 }
 
 func NewURLHandler(store store.URLStore, host string) *URLHandler {
 	return &URLHandler{
-		store: store,
-		host:  host,
+		store:     store,
+		host:      host,
+		urlPolicy: urlnorm.DefaultPolicy,
 	}
 }
 
@@ -44,6 +85,48 @@ func (h *URLHandler) SetURLProcessor(processor *workers.URLProcessor) {
 	h.urlProcessor = processor
 }
 
+// SetClickTracking enables click analytics. Redirects are queued on writer
+// and stats are read back from clicks; client IPs are hashed with ipHashKey.
+func (h *URLHandler) SetClickTracking(clicks store.ClickStore, writer *workers.ClickWriter, ipHashKey []byte) {
+	h.clickStore = clicks
+	h.clickWriter = writer
+	h.ipHashKey = ipHashKey
+}
+
+// SetCheckStore enables the link health history served by HealthHandler.
+func (h *URLHandler) SetCheckStore(checks store.CheckStore) {
+	h.checkStore = checks
+}
+
+// SetAPIKeyStore enables API key authentication with keys from keys.
+func (h *URLHandler) SetAPIKeyStore(keys store.APIKeyStore) {
+	h.apiKeys = keys
+}
+
+// SetTrustedProxies sets the proxies whose X-Forwarded-For headers are
+// believed when attributing clicks to client addresses.
+func (h *URLHandler) SetTrustedProxies(proxies TrustedProxies) {
+	h.trustedProxies = proxies
+}
+
+// SetCodeGenerators sets the code styles clients may request by name and
+// the one used when they do not ask for any.
+func (h *URLHandler) SetCodeGenerators(generators map[string]codegen.Generator, defaultStyle string) {
+	h.generators = generators
+	h.codeStyle = defaultStyle
+}
+
+// SetDedupe enables dedupe mode: shortening a URL the user has already
+// shortened returns the existing link rather than creating another.
+func (h *URLHandler) SetDedupe(enabled bool) {
+	h.dedupe = enabled
+}
+
+// SetNotFoundPage sets the HTML served when a redirect's code does not exist.
+func (h *URLHandler) SetNotFoundPage(html []byte) {
+	h.notFoundPage = html
+}
+
 func (h *URLHandler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -61,15 +144,59 @@ func (h *URLHandler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID := getUserID(w, r)
+	destination, ok := h.canonicalURL(w, req.URL)
+	if !ok {
+		return
+	}
+
+	expiresAt, err := req.expiry(time.Now())
+	if err != nil {
+		sendJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.MaxClicks < 0 {
+		sendJSONError(w, "max_clicks must be a positive number", http.StatusBadRequest)
+		return
+	}
+
+	style := req.CodeStyle
+	if style == "" {
+		style = h.codeStyle
+	}
+	generator, ok := h.generators[style]
+	if !ok && req.CodeStyle != "" {
+		sendJSONError(w, fmt.Sprintf("Unknown code_style %q", req.CodeStyle), http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if h.rejectOverloaded(w) {
+		return
+	}
 
-	code, err := h.store.SetWithOptions(req.URL, req.Alias, userID)
+	code, existing, err := h.store.SetWithOptions(r.Context(), destination, store.SetOptions{
+		Alias:     req.Alias,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		MaxClicks: req.MaxClicks,
+		Generator: generator,
+		Dedupe:    h.dedupe,
+	})
 	if err != nil {
 		switch err {
 		case store.ErrAliasInUse:
 			sendJSONError(w, "Custom alias is already in use", http.StatusConflict)
 		case store.ErrInvalidAlias:
 			sendJSONError(w, "Invalid alias: must be 3-20 alphanumeric characters", http.StatusBadRequest)
+		case store.ErrReservedAlias:
+			sendJSONError(w, "Alias is reserved, please choose another", http.StatusBadRequest)
+		case store.ErrCodeSpaceExhausted:
+			sendJSONError(w, "Could not allocate a short code, please retry", http.StatusServiceUnavailable)
 		default:
 			sendJSONError(w, fmt.Sprintf("Failed to shorten URL: %v", err), http.StatusInternalServerError)
 		}
@@ -78,21 +205,66 @@ func (h *URLHandler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 
 	shortURL := fmt.Sprintf("%s/r/%s", h.host, code)
 
+	// The existing link is described as stored, not as this request
+	// asked for it.
+	if existing {
+		entry, err := h.store.Lookup(r.Context(), code)
+		if err != nil {
+			sendJSONError(w, "Failed to get URL", http.StatusInternalServerError)
+			return
+		}
+		sendJSONResponse(w, ShortenResponse{
+			Code:       code,
+			URL:        shortURL,
+			ExpiresAt:  entry.ExpiresAt,
+			ClicksLeft: entry.ClicksRemaining,
+			Existing:   true,
+		}, http.StatusOK)
+		return
+	}
+
 	go func() {
-		log.Printf("Shortened URL: %s -> %s (user: %s)", req.URL, shortURL, userID)
+		log.Printf("Shortened URL: %s -> %s (user: %s)", destination, shortURL, userID)
 	}()
 
+	// A check the processor has no room for is left to the health
+	// scheduler, which picks up links that have never been checked.
 	if h.urlProcessor != nil {
-		h.urlProcessor.ProcessURL(req.URL)
+		h.urlProcessor.TryProcess(code, destination)
 	}
 
 	resp := ShortenResponse{
 		Code: code,
 		URL:  shortURL,
 	}
+	if !expiresAt.IsZero() {
+		resp.ExpiresAt = &expiresAt
+	}
+	if req.MaxClicks > 0 {
+		resp.ClicksLeft = &req.MaxClicks
+	}
 	sendJSONResponse(w, resp, http.StatusCreated)
 }
 
+// expiry resolves the relative or absolute expiry in the request to an
+// absolute time. A zero time means the link never expires.
+func (req ShortenRequest) expiry(now time.Time) (time.Time, error) {
+	switch {
+	case req.ExpiresIn != 0 && req.ExpiresAt != nil:
+		return time.Time{}, errors.New("only one of expires_in and expires_at may be set")
+	case req.ExpiresIn < 0:
+		return time.Time{}, errors.New("expires_in must be a positive number of seconds")
+	case req.ExpiresIn > 0:
+		return now.Add(time.Duration(req.ExpiresIn) * time.Second), nil
+	case req.ExpiresAt != nil:
+		if !req.ExpiresAt.After(now) {
+			return time.Time{}, errors.New("expires_at must be in the future")
+		}
+		return *req.ExpiresAt, nil
+	}
+	return time.Time{}, nil
+}
+
 func (h *URLHandler) RedirectHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -105,39 +277,74 @@ func (h *URLHandler) RedirectHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	url, err := h.store.Get(code)
+	// Aliases are matched case-insensitively, so the click is counted under
+	// the stored code rather than under the form visited.
+	entry, err := h.store.Resolve(r.Context(), code)
 	if err != nil {
-		if err == store.ErrCodeNotFound {
-			http.Error(w, "URL not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.sendRedirectError(w, err)
 		return
 	}
 
-	go func() {
-		logRedirect(r.Context(), code)
-	}()
+	h.recordClick(r, entry.Code)
 
-	http.Redirect(w, r, url, http.StatusFound)
+	http.Redirect(w, r, entry.URL, http.StatusFound)
 }
 
-func logRedirect(_ context.Context, code string) {
-	logEntry := struct {
-		Code      string    `json:"code"`
-		Timestamp time.Time `json:"time"`
-	}{
-		Code:      code,
-		Timestamp: time.Now(),
+func (h *URLHandler) sendRedirectError(w http.ResponseWriter, err error) {
+	switch err {
+	case store.ErrCodeNotFound:
+		h.sendNotFoundPage(w)
+		return
+	case store.ErrCodeExpired:
+		http.Error(w, "URL has expired", http.StatusGone)
+		return
+	case store.ErrClicksExhausted:
+		http.Error(w, "URL has reached its click limit", http.StatusGone)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Timed out looking up URL", http.StatusGatewayTimeout)
+		return
 	}
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
 
-	jsonData, err := json.Marshal(logEntry)
-	if err != nil {
-		log.Printf("Error marshaling log entry: %v", err)
+func (h *URLHandler) sendNotFoundPage(w http.ResponseWriter) {
+	if h.notFoundPage == nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	log.Println(string(jsonData))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusNotFound)
+	w.Write(h.notFoundPage)
+}
+
+// URLResourceHandler serves the per-link endpoints under /api/urls/{code}.
+func (h *URLHandler) URLResourceHandler(w http.ResponseWriter, r *http.Request) {
+	code, resource, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/urls/"), "/")
+	if code == "" {
+		sendJSONError(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	switch resource {
+	case "":
+		switch r.Method {
+		case http.MethodPatch:
+			h.UpdateURLHandler(w, r, code)
+		case http.MethodDelete:
+			h.DeleteURLHandler(w, r, code)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	case "stats":
+		h.StatsHandler(w, r, code)
+	case "health":
+		h.HealthHandler(w, r, code)
+	default:
+		sendJSONError(w, "Not found", http.StatusNotFound)
+	}
 }
 
 func sendJSONResponse(w http.ResponseWriter, data any, statusCode int) {
@@ -148,6 +355,28 @@ func sendJSONResponse(w http.ResponseWriter, data any, statusCode int) {
 	}
 }
 
+// canonicalURL checks a submitted destination against the URL policy and
+// returns its canonical form. A rejected URL is answered with 400 and ok is
+// false.
+func (h *URLHandler) canonicalURL(w http.ResponseWriter, raw string) (canonical string, ok bool) {
+	canonical, err := h.urlPolicy.Canonicalize(raw)
+	if err != nil {
+		var urlErr *urlnorm.Error
+		if !errors.As(err, &urlErr) {
+			sendJSONError(w, "Invalid URL", http.StatusBadRequest)
+			return "", false
+		}
+		resp := ErrorResponse{
+			Error:  "Invalid URL: " + urlErr.Message,
+			Reason: urlErr.Reason,
+		}
+		sendJSONResponse(w, resp, http.StatusBadRequest)
+		return "", false
+	}
+
+	return canonical, true
+}
+
 func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
 	resp := ErrorResponse{
 		Error: message,
@@ -155,13 +384,35 @@ func sendJSONError(w http.ResponseWriter, message string, statusCode int) {
 	sendJSONResponse(w, resp, statusCode)
 }
 
-func getUserID(w http.ResponseWriter, r *http.Request) string {
+// getUserID identifies the caller. Requests with an Authorization bearer
+// token act as the owner of that API key; browsers are identified by the
+// user_id cookie, which is created on first use. An invalid API key is
+// answered with 401 and ok is false.
+func (h *URLHandler) getUserID(w http.ResponseWriter, r *http.Request) (userID string, ok bool) {
+	if token, present := bearerToken(r); present {
+		if h.apiKeys == nil {
+			sendUnauthorized(w)
+			return "", false
+		}
+
+		key, err := h.apiKeys.LookupAPIKey(store.HashAPIKey(token))
+		if err != nil {
+			if err != store.ErrAPIKeyNotFound {
+				log.Printf("Error looking up API key: %v", err)
+			}
+			sendUnauthorized(w)
+			return "", false
+		}
+
+		return key.UserID, true
+	}
+
 	cookie, err := r.Cookie("user_id")
 	if err == nil && cookie.Value != "" {
-		return cookie.Value
+		return cookie.Value, true
 	}
 
-	userID := uuid.NewString()
+	userID = uuid.NewString()
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "user_id",
@@ -172,7 +423,12 @@ func getUserID(w http.ResponseWriter, r *http.Request) string {
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	return userID
+	return userID, true
+}
+
+func sendUnauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	sendJSONError(w, "Invalid API key", http.StatusUnauthorized)
 }
 
 func (h *URLHandler) GetUserURLsHandler(w http.ResponseWriter, r *http.Request) {
@@ -181,30 +437,124 @@ func (h *URLHandler) GetUserURLsHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	userID := getUserID(w, r)
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
 
-	entries, err := h.store.GetByUser(userID)
+	entries, err := h.store.GetByUser(r.Context(), userID)
 	if err != nil {
 		sendJSONError(w, "Failed to get URLs", http.StatusInternalServerError)
 		return
 	}
 
-	type UserURL struct {
-		Code        string    `json:"code"`
-		ShortURL    string    `json:"short_url"`
-		OriginalURL string    `json:"original_url"`
-		CreatedAt   time.Time `json:"created_at"`
-	}
-
 	userURLs := make([]UserURL, 0, len(entries))
 	for _, entry := range entries {
-		userURLs = append(userURLs, UserURL{
-			Code:        entry.Code,
-			ShortURL:    fmt.Sprintf("%s/r/%s", h.host, entry.Code),
-			OriginalURL: entry.URL,
-			CreatedAt:   entry.CreatedAt,
-		})
+		userURLs = append(userURLs, h.userURL(entry))
 	}
 
 	sendJSONResponse(w, userURLs, http.StatusOK)
 }
+
+func (h *URLHandler) userURL(entry store.URLEntry) UserURL {
+	return UserURL{
+		Code:        entry.Code,
+		ShortURL:    fmt.Sprintf("%s/r/%s", h.host, entry.Code),
+		OriginalURL: entry.URL,
+		CreatedAt:   entry.CreatedAt,
+		ExpiresAt:   entry.ExpiresAt,
+		ClicksLeft:  entry.ClicksRemaining,
+		Metadata:    entry.Metadata,
+	}
+}
+
+// UpdateURLHandler changes the destination of a link owned by the caller.
+func (h *URLHandler) UpdateURLHandler(w http.ResponseWriter, r *http.Request, code string) {
+	var req UpdateURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendJSONError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.URL == "" {
+		sendJSONError(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+
+	destination, ok := h.canonicalURL(w, req.URL)
+	if !ok {
+		return
+	}
+
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if h.rejectOverloaded(w) {
+		return
+	}
+
+	if err := h.store.Update(r.Context(), code, destination, userID); err != nil {
+		sendOwnershipError(w, err, "Failed to update URL")
+		return
+	}
+
+	entry, err := h.store.Lookup(r.Context(), code)
+	if err != nil {
+		sendJSONError(w, "Failed to get URL", http.StatusInternalServerError)
+		return
+	}
+
+	if h.urlProcessor != nil {
+		h.urlProcessor.TryProcess(entry.Code, destination)
+	}
+
+	sendJSONResponse(w, h.userURL(entry), http.StatusOK)
+}
+
+// overloadRetryAfter is the Retry-After, in seconds, sent with requests
+// turned away while the URL processor is overloaded.
+const overloadRetryAfter = "5"
+
+// rejectOverloaded answers with 503 if the URL processor is rejecting new
+// jobs, so new destinations are turned away before they are saved rather
+// than saved unchecked.
+func (h *URLHandler) rejectOverloaded(w http.ResponseWriter) bool {
+	if h.urlProcessor == nil || !h.urlProcessor.Overloaded() {
+		return false
+	}
+
+	w.Header().Set("Retry-After", overloadRetryAfter)
+	sendJSONError(w, "Server is busy, please retry shortly", http.StatusServiceUnavailable)
+	return true
+}
+
+// DeleteURLHandler removes a link owned by the caller along with its clicks
+// and check history.
+func (h *URLHandler) DeleteURLHandler(w http.ResponseWriter, r *http.Request, code string) {
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.store.Delete(r.Context(), code, userID); err != nil {
+		sendOwnershipError(w, err, "Failed to delete URL")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func sendOwnershipError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case store.ErrCodeNotFound:
+		sendJSONError(w, "URL not found", http.StatusNotFound)
+	case store.ErrNotOwner:
+		sendJSONError(w, "You do not own this URL", http.StatusForbidden)
+	case store.ErrInvalidURL:
+		sendJSONError(w, "URL is required", http.StatusBadRequest)
+	default:
+		sendJSONError(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+	"github.com/priyankeshh/url-shortener/backend/urlnorm"
+	"github.com/priyankeshh/url-shortener/backend/workers"
+)
+
+func TestShortenHandler_CanonicalizesURL(t *testing.T) {
+	urlStore := store.NewInMemoryURLStore()
+	handler := NewURLHandler(urlStore, "http://short.test")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"HTTPS://Bücher.Example:443/%7euser"}`))
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "owner"})
+	rec := httptest.NewRecorder()
+	handler.ShortenHandler(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	url, err := urlStore.Get(context.Background(), resp.Code)
+	if err != nil || url != "https://xn--bcher-kva.example/~user" {
+		t.Errorf("Expected the canonical URL to be stored, got %q (%v)", url, err)
+	}
+}
+
+// matchingStore reports every link it is asked to create as a dedupe match
+// of code.
+type matchingStore struct {
+	store.URLStore
+	code string
+}
+
+func (s *matchingStore) SetWithOptions(ctx context.Context, url string, opts store.SetOptions) (string, bool, error) {
+	return s.code, true, nil
+}
+
+func TestShortenHandler_ExistingLinkAsStored(t *testing.T) {
+	memoryStore := store.NewInMemoryURLStore()
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	code, _, err := memoryStore.SetWithOptions(context.Background(), "https://example.com", store.SetOptions{
+		UserID:    "owner",
+		ExpiresAt: expiresAt,
+		MaxClicks: 3,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	handler := NewURLHandler(&matchingStore{URLStore: memoryStore, code: code}, "http://short.test")
+	handler.SetDedupe(true)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "owner"})
+	rec := httptest.NewRecorder()
+	handler.ShortenHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var resp ShortenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !resp.Existing || resp.Code != code {
+		t.Errorf("Expected existing link %s, got %+v", code, resp)
+	}
+	if resp.ExpiresAt == nil || !resp.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("Expected expires_at %v, got %v", expiresAt, resp.ExpiresAt)
+	}
+	if resp.ClicksLeft == nil || *resp.ClicksLeft != 3 {
+		t.Errorf("Expected 3 clicks remaining, got %v", resp.ClicksLeft)
+	}
+}
+
+func TestShortenHandler_RejectsURL(t *testing.T) {
+	handler := NewURLHandler(store.NewInMemoryURLStore(), "http://short.test")
+
+	tests := []struct {
+		url    string
+		reason urlnorm.Reason
+	}{
+		{"javascript:alert(1)", urlnorm.ReasonSchemeNotAllowed},
+		{"https://www.bank.com@evil.example/", urlnorm.ReasonUserinfo},
+		{"not a url", urlnorm.ReasonMalformed},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(ShortenRequest{URL: tt.url})
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(string(body)))
+		rec := httptest.NewRecorder()
+		handler.ShortenHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d: %s", tt.url, rec.Code, rec.Body)
+			continue
+		}
+
+		var resp ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if resp.Reason != tt.reason {
+			t.Errorf("%q: expected reason %s, got %s (%s)", tt.url, tt.reason, resp.Reason, resp.Error)
+		}
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	ctx := context.Background()
+	urlStore := store.NewInMemoryURLStore()
+	checks := store.NewInMemoryCheckStore()
+	handler := NewURLHandler(urlStore, "http://short.test")
+	handler.SetCheckStore(checks)
+
+	code, _, err := urlStore.SetWithOptions(ctx, "https://example.com", store.SetOptions{UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	get := func(userID, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/"+code+"/health"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "user_id", Value: userID})
+		rec := httptest.NewRecorder()
+		handler.URLResourceHandler(rec, req)
+		return rec
+	}
+
+	var resp LinkHealthResponse
+	rec := get("owner", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Health != "unknown" || len(resp.Checks) != 0 {
+		t.Errorf("Expected an unchecked link, got %+v", resp)
+	}
+
+	checkedAt := time.Now()
+	meta := store.LinkMetadata{CheckedAt: checkedAt, Status: store.CheckFailed, Health: store.LinkBroken, HealthSince: &checkedAt, Failures: 2}
+	if err := urlStore.SetMetadata(ctx, code, "https://example.com", meta); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		check := store.LinkCheck{Code: code, URL: "https://example.com", CheckedAt: checkedAt, Status: store.CheckFailed, Health: store.LinkBroken}
+		if err := checks.RecordCheck(check); err != nil {
+			t.Fatalf("Failed to record check: %v", err)
+		}
+	}
+
+	rec = get("owner", "?limit=2")
+	resp = LinkHealthResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Health != store.LinkBroken || resp.Failures != 2 || len(resp.Checks) != 2 {
+		t.Errorf("Expected a broken link with 2 checks, got %+v", resp)
+	}
+
+	if rec := get("owner", "?limit=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %d", rec.Code)
+	}
+	if rec := get("someone-else", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for another user's link, got %d", rec.Code)
+	}
+}
+
+func TestShortenHandler_RejectsWhenOverloaded(t *testing.T) {
+	handler := NewURLHandler(store.NewInMemoryURLStore(), "http://short.test")
+	// Without workers the queue stays full after one job
+	processor := workers.NewURLProcessorWithConfig(workers.URLProcessorConfig{QueueSize: 1, Overflow: workers.OverflowReject})
+	defer processor.Stop()
+	handler.SetURLProcessor(processor)
+
+	shorten := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+		rec := httptest.NewRecorder()
+		handler.ShortenHandler(rec, req)
+		return rec
+	}
+
+	if rec := shorten(); rec.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", rec.Code, rec.Body)
+	}
+	rec := shorten()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected 503, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+}
+
+func TestRedirectHandler_MixedCaseAliasStats(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := store.NewInMemoryURLStore()
+	urlStore := store.NewValidatingURLStore(memoryStore, store.DefaultAliasPolicy)
+	clicks := memoryStore.ClickStore()
+	writer := workers.NewClickWriter(clicks, 16, 1, time.Hour)
+	defer writer.Stop()
+	handler := NewURLHandler(urlStore, "http://short.test")
+	handler.SetClickTracking(clicks, writer, []byte("key"))
+
+	code, _, err := urlStore.SetWithOptions(ctx, "https://example.com", store.SetOptions{Alias: "MyLink", UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/r/MyLink", nil)
+	rec := httptest.NewRecorder()
+	handler.RedirectHandler(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected 302, got %d: %s", rec.Code, rec.Body)
+	}
+
+	// A batch size of 1 writes each click as soon as it is read.
+	var stats store.ClickStats
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if stats, err = clicks.ClickStats(code, time.Time{}, 10); err == nil && stats.TotalClicks > 0 {
+			break
+		}
+	}
+
+	for _, visit := range []string{code, "MyLink"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/"+visit+"/stats", nil)
+		req.AddCookie(&http.Cookie{Name: "user_id", Value: "owner"})
+		rec := httptest.NewRecorder()
+		handler.URLResourceHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", visit, rec.Code, rec.Body)
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&stats); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if stats.TotalClicks != 1 {
+			t.Errorf("%s: expected 1 click, got %d", visit, stats.TotalClicks)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/urls/MyLink", nil)
+	req.AddCookie(&http.Cookie{Name: "user_id", Value: "owner"})
+	rec = httptest.NewRecorder()
+	handler.URLResourceHandler(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if stats, _ := clicks.ClickStats(code, time.Time{}, 10); stats.TotalClicks != 0 {
+		t.Errorf("Expected the alias's clicks to be deleted, got %d", stats.TotalClicks)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+const defaultHealthChecks = 20
+
+// healthUnknown is reported for links that have not been checked yet.
+const healthUnknown = "unknown"
+
+type LinkHealthResponse struct {
+	Code        string     `json:"code"`
+	URL         string     `json:"url"`
+	Health      string     `json:"health"`
+	HealthSince *time.Time `json:"health_since,omitempty"`
+	// Failures counts the consecutive failed checks.
+	Failures    int               `json:"failures"`
+	NextCheckAt *time.Time        `json:"next_check_at,omitempty"`
+	Checks      []store.LinkCheck `json:"checks"`
+}
+
+// HealthHandler returns the health and recent check history of a link
+// owned by the caller.
+func (h *URLHandler) HealthHandler(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.checkStore == nil {
+		sendJSONError(w, "Link health checks are not enabled", http.StatusNotFound)
+		return
+	}
+
+	limit := defaultHealthChecks
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > store.MaxCheckHistory {
+			sendJSONError(w, "limit must be between 1 and "+strconv.Itoa(store.MaxCheckHistory), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entry, ok := h.ownedEntry(w, r, code)
+	if !ok {
+		return
+	}
+
+	checks, err := h.checkStore.CheckHistory(entry.Code, limit)
+	if err != nil {
+		sendJSONError(w, "Failed to get check history", http.StatusInternalServerError)
+		return
+	}
+
+	response := LinkHealthResponse{
+		Code:   entry.Code,
+		URL:    entry.URL,
+		Health: healthUnknown,
+		Checks: checks,
+	}
+	if meta := entry.Metadata; meta != nil && meta.Health != "" {
+		response.Health = meta.Health
+		response.HealthSince = meta.HealthSince
+		response.Failures = meta.Failures
+		response.NextCheckAt = meta.NextCheckAt
+	}
+
+	sendJSONResponse(w, response, http.StatusOK)
+}
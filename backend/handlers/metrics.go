@@ -5,23 +5,50 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/priyankeshh/url-shortener/backend/metrics"
 )
 
-type RequestMetrics struct {
-	TotalRequests      int64
-	SuccessfulRequests int64
-	FailedRequests     int64
-	AverageLatency     time.Duration
-	PathCounts         map[string]int64
-	mutex              sync.RWMutex
+var (
+	httpRequests = metrics.NewCounterVec(
+		"urlshortener_http_requests_total",
+		"Total HTTP requests by method, route and status code.",
+		"method", "route", "status",
+	)
+	httpRequestDuration = metrics.NewHistogramVec(
+		"urlshortener_http_request_duration_seconds",
+		"HTTP request latency by method and route.",
+		metrics.DefaultBuckets,
+		"method", "route",
+	)
+	httpRequestsInFlight = metrics.NewGaugeVec(
+		"urlshortener_http_requests_in_flight",
+		"HTTP requests currently being served.",
+	)
+)
+
+// maxRouteSeries bounds the label sets of the per-route metrics. Routes are
+// already normalized, so this only guards against unexpected growth.
+const maxRouteSeries = 500
+
+func init() {
+	httpRequests.SetMaxSeries(maxRouteSeries)
+	httpRequestDuration.SetMaxSeries(maxRouteSeries)
+	metrics.MustRegister(httpRequests, httpRequestDuration, httpRequestsInFlight)
 }
 
-var metrics = &RequestMetrics{
-	PathCounts: make(map[string]int64),
+// metricsMethod maps request methods to a fixed set of label values, since
+// clients may send arbitrary method names.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
 }
 
 type contextKey string
@@ -31,7 +58,9 @@ const (
 	StartTimeKey = contextKey("start_time")
 )
 
-func MetricsMiddleware(next http.Handler) http.Handler {
+// MetricsMiddleware records request metrics labelled by the route template
+// from routes that matches each request.
+func MetricsMiddleware(next http.Handler, routes *Routes) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requestID := uuid.NewString()
 		startTime := time.Now()
@@ -46,26 +75,18 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 
 		w.Header().Set("X-Request-ID", requestID)
 
-		next.ServeHTTP(rw, r.WithContext(ctx))
+		httpRequestsInFlight.Inc()
+		func() {
+			defer httpRequestsInFlight.Dec()
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		}()
 
 		duration := time.Since(startTime)
 
-		metrics.mutex.Lock()
-		metrics.TotalRequests++
-		metrics.PathCounts[r.URL.Path]++
-
-		if rw.statusCode >= 400 {
-			metrics.FailedRequests++
-		} else {
-			metrics.SuccessfulRequests++
-		}
-
-		if metrics.AverageLatency == 0 {
-			metrics.AverageLatency = duration
-		} else {
-			metrics.AverageLatency = (metrics.AverageLatency + duration) / 2
-		}
-		metrics.mutex.Unlock()
+		route := routes.Template(r.URL.Path)
+		method := metricsMethod(r.Method)
+		httpRequests.Inc(method, route, strconv.Itoa(rw.statusCode))
+		httpRequestDuration.Observe(duration.Seconds(), method, route)
 
 		log.Printf(
 			"[%s] %s %s %d %s",
@@ -78,30 +99,66 @@ func MetricsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// GetMetricsHandler serves the default registry in the Prometheus text
+// format, or a human-readable summary when called with ?format=text.
 func GetMetricsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	metrics.mutex.RLock()
-	defer metrics.mutex.RUnlock()
+	if r.URL.Query().Get("format") == "text" {
+		writeTextMetrics(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", metrics.ContentType)
+	if err := metrics.DefaultRegistry.WritePrometheus(w); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+func writeTextMetrics(w http.ResponseWriter) {
+	var total, successful, failed float64
+	routeCounts := make(map[string]float64)
+	var routes []string
+
+	for _, sample := range httpRequests.Samples() {
+		route, status := sample.LabelValues[1], sample.LabelValues[2]
+
+		total += sample.Value
+		if code, _ := strconv.Atoi(status); code >= 400 {
+			failed += sample.Value
+		} else {
+			successful += sample.Value
+		}
+
+		if _, seen := routeCounts[route]; !seen {
+			routes = append(routes, route)
+		}
+		routeCounts[route] += sample.Value
+	}
 
 	successRate := 0.0
-	if metrics.TotalRequests > 0 {
-		successRate = float64(metrics.SuccessfulRequests) / float64(metrics.TotalRequests) * 100
+	if total > 0 {
+		successRate = successful / total * 100
+	}
+
+	var averageLatency time.Duration
+	if sum, count := httpRequestDuration.Totals(); count > 0 {
+		averageLatency = time.Duration(sum / float64(count) * float64(time.Second))
 	}
 
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintf(w, "# URL Shortener Metrics\n\n")
-	fmt.Fprintf(w, "Total Requests: %d\n", metrics.TotalRequests)
-	fmt.Fprintf(w, "Successful Requests: %d\n", metrics.SuccessfulRequests)
-	fmt.Fprintf(w, "Failed Requests: %d\n", metrics.FailedRequests)
+	fmt.Fprintf(w, "Total Requests: %.0f\n", total)
+	fmt.Fprintf(w, "Successful Requests: %.0f\n", successful)
+	fmt.Fprintf(w, "Failed Requests: %.0f\n", failed)
 	fmt.Fprintf(w, "Success Rate: %.2f%%\n", successRate)
-	fmt.Fprintf(w, "Average Latency: %s\n\n", metrics.AverageLatency)
+	fmt.Fprintf(w, "Average Latency: %s\n\n", averageLatency)
 
-	fmt.Fprintf(w, "# Requests by Path\n\n")
-	for path, count := range metrics.PathCounts {
-		fmt.Fprintf(w, "%s: %d\n", path, count)
+	fmt.Fprintf(w, "# Requests by Route\n\n")
+	for _, route := range routes {
+		fmt.Fprintf(w, "%s: %.0f\n", route, routeCounts[route])
 	}
 }
@@ -1,16 +1,25 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusOK)
@@ -52,3 +61,249 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+// TrustedProxies resolves the client address of a request. X-Forwarded-For
+// is only honoured when the direct peer is one of the trusted networks.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies parses a comma-separated list of CIDRs or bare IPs.
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (p TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made r. Behind trusted
+// proxies, X-Forwarded-For is walked from the right and the first address
+// that is not itself a trusted proxy is returned.
+func (p TrustedProxies) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer := net.ParseIP(host)
+	if peer == nil || !p.contains(peer) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !p.contains(hop) {
+			return hop.String()
+		}
+	}
+
+	return host
+}
+
+// RateLimit is a token bucket budget: Rate tokens per second refilling a
+// bucket of Burst tokens. A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimiterConfig struct {
+	Shorten  RateLimit
+	Redirect RateLimit
+	// IPMultiplier scales each budget into a per-IP ceiling that applies
+	// on top of the per-identity bucket, so rotating cookies or API keys
+	// from one address cannot escape the limit.
+	IPMultiplier   int
+	TrustedProxies TrustedProxies
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// bucketIdleTimeout is how long an untouched bucket is kept. Any bucket idle
+// this long has refilled completely, so dropping it changes nothing.
+const bucketIdleTimeout = 10 * time.Minute
+
+// RateLimiter applies per-client token bucket limits to the shorten and
+// redirect routes and reports the remaining budget in RateLimit-* headers.
+type RateLimiter struct {
+	config    RateLimiterConfig
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+	mutex     sync.Mutex
+}
+
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	if config.IPMultiplier < 1 {
+		config.IPMultiplier = 1
+	}
+
+	return &RateLimiter{
+		config:    config,
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+type rateDecision struct {
+	allowed    bool
+	limit      int
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// take removes one token from the bucket at key, creating it full if it
+// does not exist. The caller must hold l.mutex.
+func (l *RateLimiter) take(key string, limit RateLimit, now time.Time) rateDecision {
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit.Burst), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+elapsed*limit.Rate)
+	bucket.lastSeen = now
+
+	decision := rateDecision{limit: limit.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.allowed = true
+	} else {
+		decision.retryAfter = time.Duration((1 - bucket.tokens) / limit.Rate * float64(time.Second))
+	}
+	decision.remaining = int(bucket.tokens)
+	decision.reset = time.Duration((float64(limit.Burst) - bucket.tokens) / limit.Rate * float64(time.Second))
+
+	return decision
+}
+
+// refund returns the token taken by a request that was rejected by another
+// bucket. The caller must hold l.mutex.
+func (l *RateLimiter) refund(key string, limit RateLimit) {
+	if bucket, ok := l.buckets[key]; ok {
+		bucket.tokens = math.Min(float64(limit.Burst), bucket.tokens+1)
+	}
+}
+
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketIdleTimeout {
+		return
+	}
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// routeLimit returns the budget that applies to path and a name for it.
+func (l *RateLimiter) routeLimit(path string) (string, RateLimit) {
+	switch {
+	case path == "/api/shorten":
+		return "shorten", l.config.Shorten
+	case strings.HasPrefix(path, "/r/"):
+		return "redirect", l.config.Redirect
+	}
+	return "", RateLimit{}
+}
+
+// clientKey identifies the caller by API key, then user cookie. Identities
+// are hashed so raw credentials are never held in the bucket map.
+func clientKey(r *http.Request) string {
+	if token, ok := bearerToken(r); ok {
+		sum := sha256.Sum256([]byte(token))
+		return "key:" + hex.EncodeToString(sum[:16])
+	}
+	if cookie, err := r.Cookie("user_id"); err == nil && cookie.Value != "" {
+		return "user:" + cookie.Value
+	}
+	return ""
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, limit := l.routeLimit(r.URL.Path)
+		if limit.Rate <= 0 || limit.Burst <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ipKey := route + ":ip:" + l.config.TrustedProxies.ClientIP(r)
+		ipLimit := RateLimit{Rate: limit.Rate * float64(l.config.IPMultiplier), Burst: limit.Burst * l.config.IPMultiplier}
+
+		now := l.now()
+		l.mutex.Lock()
+		l.sweep(now)
+		var decision rateDecision
+		if identity := clientKey(r); identity != "" {
+			// The IP bucket is checked first, so identities rotated from
+			// one address cannot add buckets faster than its ceiling admits.
+			decision = l.take(ipKey, ipLimit, now)
+			if decision.allowed {
+				identityKey := route + ":" + identity
+				decision = l.take(identityKey, limit, now)
+				if !decision.allowed {
+					l.refund(ipKey, ipLimit)
+				}
+			}
+		} else {
+			decision = l.take(ipKey, limit, now)
+		}
+		l.mutex.Unlock()
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(decision.reset.Seconds()))))
+
+		if !decision.allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.retryAfter.Seconds()))))
+			sendJSONError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
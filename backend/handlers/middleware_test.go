@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Middleware(t *testing.T) {
+	limiter := NewRateLimiter(RateLimiterConfig{
+		Shorten:      RateLimit{Rate: 1, Burst: 2},
+		IPMultiplier: 2,
+	})
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	shorten := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		if userID != "" {
+			req.AddCookie(&http.Cookie{Name: "user_id", Value: userID})
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// The burst is available immediately, then requests are rejected
+	for i := 0; i < 2; i++ {
+		if rec := shorten("alice"); rec.Code != http.StatusCreated {
+			t.Fatalf("Request %d: expected 201, got %d", i+1, rec.Code)
+		}
+	}
+	rec := shorten("alice")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", rec.Header().Get("Retry-After"))
+	}
+	if rec.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %q", rec.Header().Get("RateLimit-Remaining"))
+	}
+
+	// Another user on the same address has their own budget, until the
+	// per-IP ceiling of twice the burst is reached
+	if rec := shorten("bob"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected 201 for second user, got %d", rec.Code)
+	}
+	if rec := shorten("carol"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected 201 for third user, got %d", rec.Code)
+	}
+	if rec := shorten("dave"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the IP ceiling is reached, got %d", rec.Code)
+	}
+
+	// Rejected identities are not tracked, so rotating cookies cannot grow
+	// the bucket map past the admitted users and the IP
+	for i := 0; i < 100; i++ {
+		shorten(fmt.Sprintf("rotated%d", i))
+	}
+	if n := len(limiter.buckets); n != 4 {
+		t.Errorf("Expected 4 buckets, got %d", n)
+	}
+
+	// Tokens refill over time
+	now = now.Add(2 * time.Second)
+	if rec := shorten("alice"); rec.Code != http.StatusCreated {
+		t.Errorf("Expected 201 after refill, got %d", rec.Code)
+	}
+
+	// Other routes are not limited
+	req := httptest.NewRequest(http.MethodGet, "/api/health", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected unlimited route to pass through, got %d", rec.Code)
+	}
+}
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"203.0.113.7:1234", "198.51.100.1", "203.0.113.7"},
+		{"10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.1.2.3:1234", "198.51.100.9, 198.51.100.1, 192.0.2.1", "198.51.100.1"},
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if ip := proxies.ClientIP(req); ip != tt.expected {
+			t.Errorf("ClientIP(%s, %q) = %s, expected %s", tt.remoteAddr, tt.forwarded, ip, tt.expected)
+		}
+	}
+}
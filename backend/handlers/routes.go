@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// OtherRoute labels requests that match no registered route template.
+const OtherRoute = "other"
+
+// Routes wraps an http.ServeMux and remembers the route template behind
+// each registration, so metrics can label requests by route rather than
+// by raw path and stay bounded no matter what clients request.
+type Routes struct {
+	mux       *http.ServeMux
+	templates [][]string
+}
+
+func NewRoutes() *Routes {
+	return &Routes{
+		mux: http.NewServeMux(),
+	}
+}
+
+// HandleFunc registers handler for a ServeMux pattern. A pattern without
+// a trailing slash is its own template. Subtree patterns such as "/r/"
+// match arbitrary paths, so the templates they serve, like "/r/{code}",
+// must be listed; anything else under the subtree is labelled OtherRoute.
+func (rt *Routes) HandleFunc(pattern string, handler http.HandlerFunc, templates ...string) {
+	rt.Handle(pattern, handler, templates...)
+}
+
+func (rt *Routes) Handle(pattern string, handler http.Handler, templates ...string) {
+	rt.mux.Handle(pattern, handler)
+
+	if !strings.HasSuffix(pattern, "/") || pattern == "/" {
+		templates = append(templates, pattern)
+	}
+	for _, template := range templates {
+		rt.templates = append(rt.templates, splitPath(template))
+	}
+}
+
+func (rt *Routes) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Template returns the registered template matching path, or OtherRoute.
+// Template segments written as {name} match any single non-empty segment.
+func (rt *Routes) Template(path string) string {
+	segments := splitPath(path)
+
+	for _, template := range rt.templates {
+		if matchSegments(template, segments) {
+			return "/" + strings.Join(template, "/")
+		}
+	}
+
+	return OtherRoute
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func matchSegments(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+
+	for i, part := range template {
+		isParam := strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}")
+		if isParam && segments[i] == "" {
+			return false
+		}
+		if !isParam && part != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRoutes_Template(t *testing.T) {
+	routes := NewRoutes()
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	routes.HandleFunc("/api/shorten", noop)
+	routes.HandleFunc("/api/urls/", noop, "/api/urls/{code}", "/api/urls/{code}/stats", "/api/urls/{code}/health")
+	routes.HandleFunc("/r/", noop, "/r/{code}")
+	routes.HandleFunc("/", noop)
+
+	tests := map[string]string{
+		"/api/shorten":          "/api/shorten",
+		"/api/urls/abc":         "/api/urls/{code}",
+		"/api/urls/abc/stats":   "/api/urls/{code}/stats",
+		"/api/urls/abc/health":  "/api/urls/{code}/health",
+		"/api/urls/abc/unknown": OtherRoute,
+		"/r/abc123":             "/r/{code}",
+		"/r/abc/def":            OtherRoute,
+		"/r/":                   OtherRoute,
+		"/":                     "/",
+		"/wp-login.php":         OtherRoute,
+	}
+
+	for path, expected := range tests {
+		if route := routes.Template(path); route != expected {
+			t.Errorf("Template(%q) = %q, expected %q", path, route, expected)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+const (
+	defaultStatsDays = 30
+	maxStatsDays     = 365
+	topReferrerCount = 10
+)
+
+func (h *URLHandler) recordClick(r *http.Request, code string) {
+	if h.clickWriter == nil {
+		return
+	}
+
+	h.clickWriter.Record(store.Click{
+		Code:      code,
+		Timestamp: time.Now(),
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IPHash:    h.hashIP(h.trustedProxies.ClientIP(r)),
+	})
+}
+
+// hashIP returns a keyed hash of ip, so unique visitors can be counted
+// without the raw address ever reaching the store.
+func (h *URLHandler) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, h.ipHashKey)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ownedEntry looks up code for a per-link endpoint that only its owner may
+// see. Per-link data must be read under the entry's Code, which for an
+// alias visited in another case differs from code. Other users' links are
+// reported as missing; on any failure the response has been written and ok
+// is false.
+func (h *URLHandler) ownedEntry(w http.ResponseWriter, r *http.Request, code string) (entry store.URLEntry, ok bool) {
+	userID, ok := h.getUserID(w, r)
+	if !ok {
+		return store.URLEntry{}, false
+	}
+
+	entry, err := h.store.Lookup(r.Context(), code)
+	if err != nil {
+		if err == store.ErrCodeNotFound {
+			sendJSONError(w, "URL not found", http.StatusNotFound)
+			return store.URLEntry{}, false
+		}
+		sendJSONError(w, "Failed to get URL", http.StatusInternalServerError)
+		return store.URLEntry{}, false
+	}
+
+	if entry.UserID != userID {
+		sendJSONError(w, "URL not found", http.StatusNotFound)
+		return store.URLEntry{}, false
+	}
+
+	return entry, true
+}
+
+// StatsHandler returns click analytics for a link owned by the caller.
+func (h *URLHandler) StatsHandler(w http.ResponseWriter, r *http.Request, code string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.clickStore == nil {
+		sendJSONError(w, "Click analytics are not enabled", http.StatusNotFound)
+		return
+	}
+
+	days := defaultStatsDays
+	if param := r.URL.Query().Get("days"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 1 || n > maxStatsDays {
+			sendJSONError(w, "days must be between 1 and 365", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	entry, ok := h.ownedEntry(w, r, code)
+	if !ok {
+		return
+	}
+
+	since := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, -(days - 1))
+	stats, err := h.clickStore.ClickStats(entry.Code, since, topReferrerCount)
+	if err != nil {
+		sendJSONError(w, "Failed to get stats", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, stats, http.StatusOK)
+}
@@ -2,18 +2,23 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"embed"
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
+	"github.com/priyankeshh/url-shortener/backend/codegen"
 	"github.com/priyankeshh/url-shortener/backend/handlers"
+	"github.com/priyankeshh/url-shortener/backend/metrics"
 	"github.com/priyankeshh/url-shortener/backend/store"
 	"github.com/priyankeshh/url-shortener/backend/workers"
 )
@@ -27,8 +32,47 @@ func main() {
 	host := flag.String("host", "http://localhost:8080", "Host for generated URLs")
 	dbURL := flag.String("db-url", "", "PostgreSQL connection URL")
 	workerCount := flag.Int("workers", 4, "Number of URL processor workers")
+	storeKind := flag.String("store", "", "URL store backend: postgres, file or memory (default: postgres if a database URL is set, else memory)")
+	dataDir := flag.String("data-dir", "data", "Directory for the file store")
+	shortenRate := flag.Float64("shorten-rate", 1, "Sustained /api/shorten requests per second per client (0 disables)")
+	shortenBurst := flag.Int("shorten-burst", 20, "Burst of /api/shorten requests allowed per client")
+	redirectRate := flag.Float64("redirect-rate", 20, "Sustained redirects per second per client (0 disables)")
+	redirectBurst := flag.Int("redirect-burst", 100, "Burst of redirects allowed per client")
+	trustedProxyList := flag.String("trusted-proxies", "", "Comma-separated CIDRs of proxies whose X-Forwarded-For header is trusted")
+	reapInterval := flag.Duration("reap-interval", time.Minute, "Interval between purges of expired URLs")
+	queryTimeout := flag.Duration("query-timeout", 5*time.Second, "Timeout for PostgreSQL queries (0 disables)")
+	redirectQueryTimeout := flag.Duration("redirect-query-timeout", time.Second, "Timeout for PostgreSQL lookups serving redirects (0 disables)")
+	purgeQueryTimeout := flag.Duration("purge-query-timeout", 30*time.Second, "Timeout for the PostgreSQL purge of expired URLs (0 disables)")
+	cacheSize := flag.Int("cache-size", 10000, "Number of links kept in the redirect cache (0 disables)")
+	cacheTTL := flag.Duration("cache-ttl", time.Minute, "How long a cached link is served before it is reloaded")
+	cacheNegativeTTL := flag.Duration("cache-negative-ttl", 10*time.Second, "How long a missing code is remembered (0 disables)")
+	bloomFPRate := flag.Float64("bloom-fp-rate", 0.01, "Target false-positive rate of the filter that short-circuits lookups of unknown codes (0 disables; postgres only uses the filter when this is set)")
+	bloomRefresh := flag.Duration("bloom-refresh", 5*time.Minute, "Interval between reloads of the code filter from the store (0 disables)")
+	codeStyle := flag.String("code-style", "random", "Default short code style: "+strings.Join(codegen.Styles, ", "))
+	codeAlphabet := flag.String("code-alphabet", "base62", "Alphabet of random codes: base62 or unambiguous")
+	codeLength := flag.Int("code-length", 8, "Length of random codes and minimum length of hashid codes")
+	codeWords := flag.Int("code-words", 3, "Number of words in words-style codes")
+	processorAllowList := flag.String("processor-allow", "", "Comma-separated CIDRs of internal networks the URL processor may fetch")
+	maxPageBytes := flag.Int64("max-page-bytes", workers.DefaultMaxPageBytes, "Bytes of an HTML destination the URL processor reads for link previews (0 disables)")
+	processorQueueSize := flag.Int("processor-queue-size", 0, "URL processor jobs that may wait for a worker (default twice the workers)")
+	processorOverflow := flag.String("processor-overflow", string(workers.OverflowDrop), "What to do with URL processor jobs when the queue is full: drop, spill (to a file in -data-dir) or reject (answer 503)")
+	durableJobs := flag.Bool("durable-jobs", false, "Keep URL processor jobs in a durable queue in the store (a file in -data-dir for the memory store), shared by replicas using the same database")
+	jobAttempts := flag.Int("job-attempts", workers.DefaultJobRetry.MaxAttempts, "Attempts at a durable URL processor job before it is dead-lettered")
+	jobVisibility := flag.Duration("job-visibility", workers.DefaultJobRetry.Visibility, "How long a leased durable URL processor job is hidden from other workers")
+	healthInterval := flag.Duration("health-check-interval", workers.DefaultHealthSchedulerConfig.Interval, "Interval between polls for links due for a health recheck (0 disables rechecks)")
+	healthMin := flag.Duration("health-check-min", workers.DefaultHealthSchedulerConfig.MinInterval, "Shortest time between health checks of a link")
+	healthMax := flag.Duration("health-check-max", workers.DefaultHealthSchedulerConfig.MaxInterval, "Longest time between health checks of a link")
+	brokenAfter := flag.Int("broken-after", workers.DefaultHealthSchedulerConfig.BrokenAfter, "Consecutive failed health checks before a link is marked broken")
+	dedupe := flag.Bool("dedupe", false, "Return a user's existing link when they shorten the same URL again")
 	flag.Parse()
 
+	bloomFPRateSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "bloom-fp-rate" {
+			bloomFPRateSet = true
+		}
+	})
+
 	if envPort := os.Getenv("PORT"); envPort != "" {
 		fmt.Sscanf(envPort, "%d", port)
 	}
@@ -41,8 +85,49 @@ func main() {
 	if envWorkers := os.Getenv("WORKER_COUNT"); envWorkers != "" {
 		fmt.Sscanf(envWorkers, "%d", workerCount)
 	}
+	if envStore := os.Getenv("STORE"); envStore != "" {
+		*storeKind = envStore
+	}
+	if envDataDir := os.Getenv("DATA_DIR"); envDataDir != "" {
+		*dataDir = envDataDir
+	}
+	if envProxies := os.Getenv("TRUSTED_PROXIES"); envProxies != "" {
+		*trustedProxyList = envProxies
+	}
+
+	trustedProxies, err := handlers.ParseTrustedProxies(*trustedProxyList)
+	if err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
+	processorAllow, err := workers.ParseAllowedNetworks(*processorAllowList)
+	if err != nil {
+		log.Fatalf("Invalid URL processor allow list: %v", err)
+	}
+
+	overflow, err := workers.ParseOverflowPolicy(*processorOverflow)
+	if err != nil {
+		log.Fatalf("Invalid URL processor overflow policy: %v", err)
+	}
+
+	// 0 disables the filter; a rate of 1 or more would filter nothing.
+	if !(*bloomFPRate >= 0 && *bloomFPRate < 1) {
+		log.Fatalf("Invalid code filter false-positive rate %v: must be 0, or between 0 and 1", *bloomFPRate)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(*dbURL, flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
 
 	var urlStore store.URLStore
+	var clickStore store.ClickStore
+	var checkStore store.CheckStore
+	var apiKeyStore store.APIKeyStore
+	var jobQueue store.JobQueue
+	usingPostgres := false
 	connectionURL := *dbURL
 
 	if envDBURL := os.Getenv("DATABASE_URL"); envDBURL != "" {
@@ -52,72 +137,335 @@ func main() {
 		log.Printf("DATABASE_URL environment variable not found")
 	}
 
-	if connectionURL != "" {
+	switch *storeKind {
+	case "", "postgres", "file", "memory":
+	default:
+		log.Fatalf("Unknown store %q: must be postgres, file or memory", *storeKind)
+	}
+
+	if *storeKind == "file" {
+		log.Printf("Using file store in %s", *dataDir)
+		boltStore, err := store.NewBoltURLStore(*dataDir)
+		if err != nil {
+			log.Fatalf("Failed to open file store: %v", err)
+		}
+		defer boltStore.Close()
+		urlStore = boltStore
+		clickStore = boltStore.ClickStore()
+		checkStore = boltStore.CheckStore()
+		apiKeyStore = boltStore
+		if *durableJobs {
+			jobQueue = boltStore.JobQueue()
+		}
+	} else if *storeKind == "memory" {
+		log.Printf("In-memory store selected")
+	} else if connectionURL != "" {
 		log.Printf("Attempting to connect to PostgreSQL database with connection string: %s", connectionURL)
 
 		postgresStore, err := store.NewPostgresURLStore(connectionURL)
-		if err != nil {
+		if err != nil && *storeKind == "postgres" {
+			log.Fatalf("Failed to create PostgreSQL store: %v", err)
+		} else if err != nil {
 			log.Printf("Failed to create PostgreSQL store: %v", err)
 			log.Println("Falling back to in-memory store")
 		} else {
 			log.Printf("Successfully connected to PostgreSQL database")
 			defer postgresStore.Close()
+			postgresStore.SetQueryTimeouts(store.QueryTimeouts{
+				Set:          *queryTimeout,
+				Get:          *redirectQueryTimeout,
+				Lookup:       *redirectQueryTimeout,
+				GetByUser:    *queryTimeout,
+				Update:       *queryTimeout,
+				SetMetadata:  *queryTimeout,
+				DueForCheck:  *queryTimeout,
+				Delete:       *queryTimeout,
+				PurgeExpired: *purgeQueryTimeout,
+				Stats:        *queryTimeout,
+				Jobs:         *queryTimeout,
+			})
 			urlStore = postgresStore
+			usingPostgres = true
+			clickStore = postgresStore.ClickStore()
+			checkStore = postgresStore.CheckStore()
+			apiKeyStore = postgresStore
+			if *durableJobs {
+				jobQueue = postgresStore.JobQueue()
+			}
 		}
+	} else if *storeKind == "postgres" {
+		log.Fatalf("The postgres store requires a database URL")
 	} else {
 		log.Printf("No database connection URL provided")
 	}
 
 	if urlStore == nil {
 		log.Println("Using in-memory URL store")
-		urlStore = store.NewInMemoryURLStore()
+		memoryStore := store.NewInMemoryURLStore()
+		urlStore = memoryStore
+		clickStore = memoryStore.ClickStore()
+		checkStore = memoryStore.CheckStore()
+		apiKeyStore = memoryStore
+		if *durableJobs {
+			fileQueue, err := store.OpenBoltJobQueue(filepath.Join(*dataDir, "url-queue.db"))
+			if err != nil {
+				log.Fatalf("Failed to open URL job queue: %v", err)
+			}
+			defer fileQueue.Close()
+			jobQueue = fileQueue
+		}
+	}
+
+	lister, _ := urlStore.(store.CodeLister)
+	sequence, _ := urlStore.(codegen.Sequence)
+
+	generators, err := codeGenerators(codegen.Config{
+		Alphabet: *codeAlphabet,
+		Length:   *codeLength,
+		Salt:     os.Getenv("CODE_SALT"),
+		Words:    *codeWords,
+	}, sequence)
+	if err != nil {
+		log.Fatalf("Invalid code generation settings: %v", err)
+	}
+	if _, ok := generators[*codeStyle]; !ok {
+		log.Fatalf("Unknown code style %q: must be one of %s", *codeStyle, strings.Join(codegen.Styles, ", "))
+	}
+
+	var cache *store.CachingURLStore
+	if *cacheSize > 0 {
+		cache = store.NewCachingURLStore(urlStore, *cacheSize, *cacheTTL, *cacheNegativeTTL)
+		urlStore = cache
+	}
+
+	// A shared database may have links created by other replicas, which
+	// the filter would report missing until its next rebuild, so it is
+	// only used there when asked for.
+	if usingPostgres && !bloomFPRateSet {
+		*bloomFPRate = 0
+	} else if usingPostgres && *bloomFPRate > 0 {
+		log.Printf("Code filter enabled on PostgreSQL: links created by other replicas may 404 here for up to -bloom-refresh")
+	}
+
+	// The code filter goes in front of the cache so that scans for random
+	// codes do not evict real links from it.
+	var bloom *store.BloomURLStore
+	if *bloomFPRate > 0 && lister != nil {
+		bloom = store.NewBloomURLStore(urlStore, lister, *bloomFPRate)
+		if err := bloom.Rebuild(context.Background()); err != nil {
+			log.Printf("Failed to load code filter, lookups will not be filtered: %v", err)
+			bloom = nil
+		} else {
+			urlStore = bloom
+		}
+	}
+	if bloom != nil && *bloomRefresh > 0 {
+		bloomCtx, stopBloom := context.WithCancel(context.Background())
+		defer stopBloom()
+		go bloom.Run(bloomCtx, *bloomRefresh)
+	}
+
+	// Apply the same alias rules whichever backend was chosen. The cache
+	// and filter sit underneath, so the exact and case-folded lookups both
+	// benefit from them.
+	urlStore = store.NewValidatingURLStore(urlStore, store.DefaultAliasPolicy)
+
+	ipHashKey := []byte(os.Getenv("CLICK_HASH_KEY"))
+	if len(ipHashKey) == 0 {
+		log.Println("CLICK_HASH_KEY not set, unique visitor counts will reset on restart")
+		ipHashKey = make([]byte, 32)
+		if _, err := rand.Read(ipHashKey); err != nil {
+			log.Fatalf("Failed to generate click hash key: %v", err)
+		}
+	}
+
+	clickWriter := workers.NewClickWriter(clickStore, 1024, 100, 5*time.Second)
+	defer clickWriter.Stop()
+
+	reaper := store.NewReaper(urlStore, *reapInterval)
+	defer reaper.Stop()
+
+	if jobQueue != nil && overflow != workers.OverflowDrop {
+		log.Printf("Ignoring -processor-overflow %s: the durable job queue is never full", overflow)
+	}
+
+	var spill *workers.BoltSpill
+	if overflow == workers.OverflowSpill && jobQueue == nil {
+		if err := os.MkdirAll(*dataDir, 0o755); err != nil {
+			log.Fatalf("Failed to create data directory: %v", err)
+		}
+		spill, err = workers.OpenBoltSpill(filepath.Join(*dataDir, "url-jobs.db"))
+		if err != nil {
+			log.Fatalf("Failed to open URL job spill: %v", err)
+		}
+		defer spill.Close()
+		if n := spill.Len(); n > 0 {
+			log.Printf("Resuming %d spilled URL jobs", n)
+		}
 	}
 
 	log.Printf("Starting URL processor with %d workers", *workerCount)
-	urlProcessor := workers.NewURLProcessor(*workerCount)
+	processorConfig := workers.URLProcessorConfig{
+		Workers:         *workerCount,
+		AllowedNetworks: processorAllow,
+		MaxPageBytes:    *maxPageBytes,
+		QueueSize:       *processorQueueSize,
+		Overflow:        overflow,
+		Queue:           jobQueue,
+		Retry: workers.JobRetryConfig{
+			MaxAttempts: *jobAttempts,
+			Visibility:  *jobVisibility,
+		},
+	}
+	if spill != nil {
+		processorConfig.Spill = spill
+	}
+	if jobQueue != nil {
+		log.Printf("Using the durable URL job queue")
+	}
+	urlProcessor := workers.NewURLProcessorWithConfig(processorConfig)
 	defer urlProcessor.Stop()
 
+	healthScheduler := workers.NewHealthScheduler(urlStore, checkStore, urlProcessor, workers.HealthSchedulerConfig{
+		Interval:    *healthInterval,
+		BatchSize:   workers.DefaultHealthSchedulerConfig.BatchSize,
+		MinInterval: *healthMin,
+		MaxInterval: *healthMax,
+		BrokenAfter: *brokenAfter,
+	})
+	defer healthScheduler.Stop()
+
 	go func() {
 		for result := range urlProcessor.GetResults() {
-			if result.Error != nil {
+			switch result.Outcome {
+			case workers.OutcomeBlocked:
+				log.Printf("URL processing blocked for %s: %v", result.URL, result.Error)
+			case workers.OutcomeFailed:
 				log.Printf("URL processing error for %s: %v", result.URL, result.Error)
-			} else {
-				log.Printf("URL %s processed: status=%d, content-type=%s, time=%s",
-					result.URL, result.StatusCode, result.ContentType, result.ProcessTime)
+			default:
+				log.Printf("URL %s processed: status=%d, content-type=%s, title=%q, time=%s",
+					result.URL, result.StatusCode, result.ContentType, result.Title, result.ProcessTime)
+			}
+
+			err := healthScheduler.Record(context.Background(), result)
+			if err != nil && err != store.ErrCodeNotFound {
+				log.Printf("Error saving metadata for %s: %v", result.Code, err)
 			}
 		}
 	}()
 
+	metrics.MustRegister(
+		metrics.NewGaugeFunc("urlshortener_urls", "Number of links in the URL store.", func() float64 {
+			return float64(urlStore.Stats(context.Background()))
+		}),
+		metrics.NewGaugeFunc("urlshortener_url_processor_queue_depth", "URLs waiting for a URL processor worker.", func() float64 {
+			return float64(urlProcessor.QueueDepth())
+		}),
+		metrics.NewGaugeFunc("urlshortener_url_processor_queue_capacity", "URLs that may wait for a URL processor worker.", func() float64 {
+			return float64(urlProcessor.QueueStats().Capacity)
+		}),
+		metrics.NewCounterFunc("urlshortener_url_processor_dropped_total", "URL checks dropped because the URL processor queue was full.", func() float64 {
+			return float64(urlProcessor.QueueStats().Dropped)
+		}),
+		metrics.NewCounterFunc("urlshortener_url_processor_rejected_total", "URL checks rejected because the URL processor queue was full.", func() float64 {
+			return float64(urlProcessor.QueueStats().Rejected)
+		}),
+		metrics.NewCounterFunc("urlshortener_url_processor_spilled_total", "URL checks spilled to disk because the URL processor queue was full.", func() float64 {
+			return float64(urlProcessor.QueueStats().Spilled)
+		}),
+		metrics.NewGaugeFunc("urlshortener_url_processor_spill_depth", "URL checks waiting on disk for room in the URL processor queue.", func() float64 {
+			return float64(urlProcessor.QueueStats().SpillDepth)
+		}),
+		metrics.NewGaugeFunc("urlshortener_url_jobs_leased", "Durable URL processor jobs leased by a worker.", func() float64 {
+			return float64(urlProcessor.QueueStats().Leased)
+		}),
+		metrics.NewGaugeFunc("urlshortener_url_jobs_dead_letters", "Durable URL processor jobs given up on.", func() float64 {
+			return float64(urlProcessor.QueueStats().DeadLetters)
+		}),
+		metrics.NewCounterFunc("urlshortener_url_jobs_retried_total", "Durable URL processor jobs scheduled for a retry.", func() float64 {
+			return float64(urlProcessor.QueueStats().Retried)
+		}),
+		metrics.NewCounterFunc("urlshortener_url_jobs_dead_lettered_total", "Durable URL processor jobs dead-lettered after their last attempt.", func() float64 {
+			return float64(urlProcessor.QueueStats().DeadLettered)
+		}),
+		metrics.NewCounterFunc("urlshortener_links_broken_total", "Times a link was marked broken after failing consecutive health checks.", func() float64 {
+			broken, _ := healthScheduler.Transitions()
+			return float64(broken)
+		}),
+		metrics.NewCounterFunc("urlshortener_links_recovered_total", "Times a broken link passed a health check again.", func() float64 {
+			_, recovered := healthScheduler.Transitions()
+			return float64(recovered)
+		}),
+		metrics.NewCounterFunc("urlshortener_clicks_dropped_total", "Clicks dropped because the click buffer was full.", func() float64 {
+			return float64(clickWriter.Dropped())
+		}),
+	)
+	if bloom != nil {
+		metrics.MustRegister(
+			metrics.NewCounterFunc("urlshortener_code_filter_negatives_total", "Lookups answered as missing by the code filter without reaching the store.", func() float64 {
+				negatives, _ := bloom.FilterStats()
+				return float64(negatives)
+			}),
+			metrics.NewCounterFunc("urlshortener_code_filter_false_positives_total", "Lookups passed by the code filter for codes the store did not have.", func() float64 {
+				_, falsePositives := bloom.FilterStats()
+				return float64(falsePositives)
+			}),
+			metrics.NewGaugeFunc("urlshortener_code_filter_false_positive_rate", "Observed share of missing codes the code filter failed to reject.", func() float64 {
+				negatives, falsePositives := bloom.FilterStats()
+				if negatives+falsePositives == 0 {
+					return 0
+				}
+				return float64(falsePositives) / float64(negatives+falsePositives)
+			}),
+			metrics.NewGaugeFunc("urlshortener_code_filter_estimated_false_positive_rate", "False-positive rate expected from the code filter's current fill.", bloom.EstimatedFalsePositiveRate),
+		)
+	}
+	if cache != nil {
+		metrics.MustRegister(
+			metrics.NewCounterFunc("urlshortener_url_cache_hits_total", "Link lookups served from the redirect cache.", func() float64 {
+				hits, _ := cache.CacheStats()
+				return float64(hits)
+			}),
+			metrics.NewCounterFunc("urlshortener_url_cache_misses_total", "Link lookups that went to the URL store.", func() float64 {
+				_, misses := cache.CacheStats()
+				return float64(misses)
+			}),
+			metrics.NewGaugeFunc("urlshortener_url_cache_entries", "Links held in the redirect cache.", func() float64 {
+				return float64(cache.Len())
+			}),
+		)
+	}
+
 	urlHandler := handlers.NewURLHandler(urlStore, *host)
 	urlHandler.SetURLProcessor(urlProcessor)
+	urlHandler.SetClickTracking(clickStore, clickWriter, ipHashKey)
+	urlHandler.SetCheckStore(checkStore)
+	urlHandler.SetTrustedProxies(trustedProxies)
+	urlHandler.SetAPIKeyStore(apiKeyStore)
+	urlHandler.SetCodeGenerators(generators, *codeStyle)
+	urlHandler.SetDedupe(*dedupe)
 
-	mux := http.NewServeMux()
+	notFoundPage, err := docsFS.ReadFile("docs/404.html")
+	if err != nil {
+		log.Fatalf("Failed to load 404 page: %v", err)
+	}
+	urlHandler.SetNotFoundPage(notFoundPage)
 
-	mux.HandleFunc("/api/shorten", urlHandler.ShortenHandler)
-	mux.HandleFunc("/api/urls", urlHandler.GetUserURLsHandler)
-	mux.HandleFunc("/api/metrics", handlers.GetMetricsHandler)
-	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+	routes := handlers.NewRoutes()
+
+	routes.HandleFunc("/api/shorten", urlHandler.ShortenHandler)
+	routes.HandleFunc("/api/urls", urlHandler.GetUserURLsHandler)
+	routes.HandleFunc("/api/urls/", urlHandler.URLResourceHandler, "/api/urls/{code}", "/api/urls/{code}/stats", "/api/urls/{code}/health")
+	routes.HandleFunc("/api/keys", urlHandler.APIKeysHandler)
+	routes.HandleFunc("/api/keys/", urlHandler.RevokeAPIKeyHandler, "/api/keys/{id}")
+	routes.HandleFunc("/api/metrics", handlers.GetMetricsHandler)
+	routes.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
-	mux.HandleFunc("/r/", func(w http.ResponseWriter, r *http.Request) {
-		code := strings.TrimPrefix(r.URL.Path, "/r/")
-		if _, err := urlStore.Get(code); err == store.ErrCodeNotFound {
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.WriteHeader(http.StatusNotFound)
-			notFoundHTML, err := docsFS.ReadFile("docs/404.html")
-			if err != nil {
-				http.Error(w, "URL not found", http.StatusNotFound)
-				return
-			}
-			w.Write(notFoundHTML)
-			return
-		}
+	routes.HandleFunc("/r/", urlHandler.RedirectHandler, "/r/{code}")
 
-		urlHandler.RedirectHandler(w, r)
-	})
-
-	mux.HandleFunc("/api/docs", func(w http.ResponseWriter, r *http.Request) {
+	routes.HandleFunc("/api/docs", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
 		openAPISpec, err := docsFS.ReadFile("docs/openapi.yaml")
 		if err != nil {
@@ -128,7 +476,7 @@ func main() {
 	})
 
 	fs := http.FileServer(http.Dir("static"))
-	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	routes.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasPrefix(r.URL.Path, "/api/") || strings.HasPrefix(r.URL.Path, "/r/") {
 			return
 		}
@@ -144,7 +492,19 @@ func main() {
 		fs.ServeHTTP(w, r)
 	}))
 
-	handler := handlers.MetricsMiddleware(handlers.LoggingMiddleware(handlers.CORSMiddleware(mux)))
+	rateLimiter := handlers.NewRateLimiter(handlers.RateLimiterConfig{
+		Shorten:        handlers.RateLimit{Rate: *shortenRate, Burst: *shortenBurst},
+		Redirect:       handlers.RateLimit{Rate: *redirectRate, Burst: *redirectBurst},
+		IPMultiplier:   4,
+		TrustedProxies: trustedProxies,
+	})
+
+	handler := handlers.MetricsMiddleware(handlers.LoggingMiddleware(handlers.CORSMiddleware(rateLimiter.Middleware(routes))), routes)
+
+	// Request contexts derive from baseCtx, so cancelling it aborts store
+	// queries still running when shutdown gives up waiting for them.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", *port),
@@ -152,6 +512,9 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		BaseContext: func(net.Listener) context.Context {
+			return baseCtx
+		},
 	}
 
 	go func() {
@@ -171,8 +534,45 @@ func main() {
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		log.Printf("Server forced to shutdown: %v", err)
+		cancelRequests()
+		server.Close()
+		return
 	}
 
 	log.Println("Server exited gracefully")
 }
+
+// codeGenerators builds a generator for every code style, so clients can
+// pick one per request. cfg.Style is ignored.
+func codeGenerators(cfg codegen.Config, sequence codegen.Sequence) (map[string]codegen.Generator, error) {
+	switch cfg.Alphabet {
+	case "base62":
+		cfg.Alphabet = codegen.Base62
+	case "unambiguous":
+		cfg.Alphabet = codegen.Unambiguous
+	default:
+		return nil, fmt.Errorf("unknown code alphabet %q: must be base62 or unambiguous", cfg.Alphabet)
+	}
+
+	if cfg.Salt == "" {
+		log.Println("CODE_SALT not set, hashid codes will use a random salt until restart")
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		cfg.Salt = string(salt)
+	}
+
+	generators := make(map[string]codegen.Generator)
+	for _, style := range codegen.Styles {
+		cfg.Style = style
+		generator, err := codegen.New(cfg, sequence)
+		if err != nil {
+			return nil, err
+		}
+		generators[style] = generator
+	}
+
+	return generators, nil
+}
@@ -0,0 +1,414 @@
+// Package metrics is a small metrics registry that renders counters,
+// gauges and histograms in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are histogram upper bounds in seconds suited to HTTP
+// request latencies.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Collector is a metric family that can render itself.
+type Collector interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	mutex      sync.RWMutex
+	collectors []Collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		names: make(map[string]bool),
+	}
+}
+
+// DefaultRegistry is the registry served by the application.
+var DefaultRegistry = NewRegistry()
+
+func (r *Registry) Register(c Collector) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.names[c.Name()] {
+		return fmt.Errorf("metric %q is already registered", c.Name())
+	}
+	r.names[c.Name()] = true
+	r.collectors = append(r.collectors, c)
+
+	return nil
+}
+
+func (r *Registry) MustRegister(collectors ...Collector) {
+	for _, c := range collectors {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func MustRegister(collectors ...Collector) {
+	DefaultRegistry.MustRegister(collectors...)
+}
+
+// WritePrometheus renders every registered metric, sorted by name.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mutex.RLock()
+	collectors := make([]Collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.mutex.RUnlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Name() < collectors[j].Name()
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Sample is the current value of one labelled series.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// vec holds the label schema and series of one metric family. Series are
+// keyed by their label values joined with a separator that cannot appear
+// in valid UTF-8.
+type vec struct {
+	name      string
+	help      string
+	labels    []string
+	maxSeries int
+	mutex     sync.Mutex
+}
+
+const labelSeparator = "\xff"
+
+// OverflowLabelValue replaces every label value of observations that would
+// push a family past its series limit.
+const OverflowLabelValue = "other"
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %q expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, labelSeparator)
+}
+
+// SetMaxSeries caps the number of distinct label sets in the family. Once
+// the cap is reached, new label sets are folded into a single series whose
+// labels are all OverflowLabelValue. Zero means no limit.
+func (v *vec) SetMaxSeries(n int) {
+	v.mutex.Lock()
+	v.maxSeries = n
+	v.mutex.Unlock()
+}
+
+// boundedKey returns key, or the overflow key if key is new and the family
+// is full. The caller must hold v.mutex.
+func (v *vec) boundedKey(key string, exists bool, size int) string {
+	if exists || v.maxSeries <= 0 || size < v.maxSeries {
+		return key
+	}
+
+	overflow := make([]string, len(v.labels))
+	for i := range overflow {
+		overflow[i] = OverflowLabelValue
+	}
+	return strings.Join(overflow, labelSeparator)
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+func (v *vec) writeHeader(w *bufio.Writer, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, escapeHelp(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, kind)
+}
+
+// writeSample writes one sample line. extraName and extraValue add a
+// trailing label such as a histogram's le.
+func (v *vec) writeSample(w *bufio.Writer, suffix, key, extraName, extraValue string, value float64) {
+	w.WriteString(v.name)
+	w.WriteString(suffix)
+
+	var labelValues []string
+	if len(v.labels) > 0 {
+		labelValues = strings.Split(key, labelSeparator)
+	}
+	if len(labelValues) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, label := range v.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+		}
+		if extraName != "" {
+			if len(v.labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func sortedKeys[T any](series map[string]T) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type valueVec struct {
+	vec
+	kind   string
+	values map[string]float64
+}
+
+func newValueVec(kind, name, help string, labels []string) valueVec {
+	return valueVec{
+		vec:    vec{name: name, help: help, labels: labels},
+		kind:   kind,
+		values: make(map[string]float64),
+	}
+}
+
+func (v *valueVec) add(delta float64, labelValues []string) {
+	key := v.key(labelValues)
+
+	v.mutex.Lock()
+	_, exists := v.values[key]
+	key = v.boundedKey(key, exists, len(v.values))
+	v.values[key] += delta
+	v.mutex.Unlock()
+}
+
+func (v *valueVec) write(w *bufio.Writer) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	v.writeHeader(w, v.kind)
+	for _, key := range sortedKeys(v.values) {
+		v.writeSample(w, "", key, "", "", v.values[key])
+	}
+}
+
+// Samples returns the current value of every series.
+func (v *valueVec) Samples() []Sample {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	samples := make([]Sample, 0, len(v.values))
+	for _, key := range sortedKeys(v.values) {
+		sample := Sample{Value: v.values[key]}
+		if len(v.labels) > 0 {
+			sample.LabelValues = strings.Split(key, labelSeparator)
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples
+}
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct {
+	valueVec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newValueVec("counter", name, help, labels)}
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("counter %q cannot decrease", c.name))
+	}
+	c.add(delta, labelValues)
+}
+
+// GaugeVec is a family of values that can go up and down.
+type GaugeVec struct {
+	valueVec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newValueVec("gauge", name, help, labels)}
+}
+
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.add(1, labelValues)
+}
+
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.add(-1, labelValues)
+}
+
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.mutex.Lock()
+	_, exists := g.values[key]
+	key = g.boundedKey(key, exists, len(g.values))
+	g.values[key] = value
+	g.mutex.Unlock()
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a family of histograms sharing the same buckets.
+type HistogramVec struct {
+	vec
+	buckets []float64
+	series  map[string]*histogram
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return &HistogramVec{
+		vec:     vec{name: name, help: help, labels: labels},
+		buckets: sorted,
+		series:  make(map[string]*histogram),
+	}
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	hist, ok := h.series[key]
+	if !ok {
+		key = h.boundedKey(key, false, len(h.series))
+		hist, ok = h.series[key]
+	}
+	if !ok {
+		hist = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = hist
+	}
+
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += value
+	hist.count++
+}
+
+// Totals returns the sum and count of observations across all series.
+func (h *HistogramVec) Totals() (sum float64, count uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for _, hist := range h.series {
+		sum += hist.sum
+		count += hist.count
+	}
+
+	return sum, count
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		hist := h.series[key]
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += hist.counts[i]
+			h.writeSample(w, "_bucket", key, "le", formatFloat(bound), float64(cumulative))
+		}
+		h.writeSample(w, "_bucket", key, "le", "+Inf", float64(hist.count))
+		h.writeSample(w, "_sum", key, "", "", hist.sum)
+		h.writeSample(w, "_count", key, "", "", float64(hist.count))
+	}
+}
+
+// funcMetric reports a single unlabelled value computed at scrape time.
+type funcMetric struct {
+	vec
+	kind string
+	fn   func() float64
+}
+
+// NewGaugeFunc returns a gauge whose value is read from fn on each scrape.
+func NewGaugeFunc(name, help string, fn func() float64) Collector {
+	return &funcMetric{vec: vec{name: name, help: help}, kind: "gauge", fn: fn}
+}
+
+// NewCounterFunc returns a counter whose value is read from fn on each
+// scrape. fn must never return a smaller value than before.
+func NewCounterFunc(name, help string, fn func() float64) Collector {
+	return &funcMetric{vec: vec{name: name, help: help}, kind: "counter", fn: fn}
+}
+
+func (f *funcMetric) write(w *bufio.Writer) {
+	f.writeHeader(w, f.kind)
+	f.writeSample(w, "", "", "", "", f.fn())
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WritePrometheus(t *testing.T) {
+	registry := NewRegistry()
+
+	requests := NewCounterVec("requests_total", "Total requests.", "path")
+	latency := NewHistogramVec("latency_seconds", "Request latency.", []float64{0.1, 1})
+	queue := NewGaugeFunc("queue_depth", "Queued jobs.", func() float64 { return 3 })
+	registry.MustRegister(requests, latency, queue)
+
+	requests.Inc("/a")
+	requests.Add(2, `/b"\`)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var out strings.Builder
+	if err := registry.WritePrometheus(&out); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	expected := `# HELP latency_seconds Request latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 5.55
+latency_seconds_count 3
+# HELP queue_depth Queued jobs.
+# TYPE queue_depth gauge
+queue_depth 3
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{path="/a"} 1
+requests_total{path="/b\"\\"} 2
+`
+	if out.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	registry := NewRegistry()
+
+	if err := registry.Register(NewCounterVec("dup", "First.")); err != nil {
+		t.Fatalf("Failed to register metric: %v", err)
+	}
+	if err := registry.Register(NewGaugeVec("dup", "Second.")); err == nil {
+		t.Error("Expected an error registering a duplicate name")
+	}
+}
+
+func TestCounterVec_MaxSeries(t *testing.T) {
+	requests := NewCounterVec("requests_total", "Total requests.", "route", "status")
+	requests.SetMaxSeries(2)
+
+	requests.Inc("/a", "200")
+	requests.Inc("/b", "200")
+	requests.Inc("/c", "200")
+	requests.Inc("/d", "404")
+	requests.Inc("/a", "200")
+
+	samples := requests.Samples()
+	if len(samples) != 3 {
+		t.Fatalf("Expected 2 series plus overflow, got %v", samples)
+	}
+
+	overflow := samples[2]
+	if overflow.LabelValues[0] != OverflowLabelValue || overflow.LabelValues[1] != OverflowLabelValue {
+		t.Errorf("Expected overflow series last, got %v", overflow)
+	}
+	if overflow.Value != 2 {
+		t.Errorf("Expected 2 overflowed increments, got %v", overflow.Value)
+	}
+}
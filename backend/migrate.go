@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate implements the "migrate" subcommand for managing the
+// PostgreSQL schema without starting the server.
+func runMigrate(connStr string, args []string) error {
+	if connStr == "" {
+		return errors.New("a database URL is required (-db-url or DATABASE_URL)")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	migrator, err := store.NewPostgresMigrator(connStr)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reverted %d migrations\n", reverted)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		tw.Flush()
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// AliasPolicy decides which custom aliases users may reserve. Aliases are
+// case-insensitive: Normalize folds them to lower case, and that is the form
+// stored.
+type AliasPolicy struct {
+	MinLength int
+	MaxLength int
+	// Reserved holds words that would be confused with the service's own
+	// paths. An alias is rejected if it matches one of them after case
+	// folding and lookalike characters are mapped, so "AP1" and "dосs"
+	// (with Cyrillic letters) are refused as well as "api" and "docs".
+	Reserved []string
+}
+
+var DefaultAliasPolicy = AliasPolicy{
+	MinLength: 3,
+	MaxLength: 20,
+	Reserved: []string{
+		"admin", "api", "app", "assets", "docs", "health", "help",
+		"login", "logout", "metrics", "static", "status", "www",
+	},
+}
+
+// Normalize checks alias against the policy and returns the form to store.
+func (p AliasPolicy) Normalize(alias string) (string, error) {
+	length := utf8.RuneCountInString(alias)
+	if length < p.MinLength || length > p.MaxLength {
+		return "", ErrInvalidAlias
+	}
+
+	folded := strings.ToLower(alias)
+
+	skeleton := aliasSkeleton(folded)
+	for _, word := range p.Reserved {
+		if skeleton == aliasSkeleton(word) {
+			return "", ErrReservedAlias
+		}
+	}
+
+	for i := 0; i < len(folded); i++ {
+		c := folded[i]
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return "", ErrInvalidAlias
+		}
+	}
+
+	return folded, nil
+}
+
+// confusables maps characters to the ASCII letter they are commonly mistaken
+// for. Digits that pass for letters are included because an alias is read
+// by people, not just routers.
+var confusables = map[rune]rune{
+	'0': 'o', '1': 'l', 'i': 'l', '|': 'l', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'l', 'ј': 'j', 'ԁ': 'd',
+	// Greek
+	'α': 'a', 'ε': 'e', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+}
+
+// aliasSkeleton reduces a folded alias to a canonical form in which
+// visually similar strings compare equal.
+func aliasSkeleton(alias string) string {
+	var b strings.Builder
+	for _, r := range alias {
+		// Fullwidth forms of ASCII letters and digits.
+		if r >= 0xFF01 && r <= 0xFF5E {
+			r = unicode.ToLower(r - 0xFEE0)
+		}
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ValidatingURLStore applies an AliasPolicy in front of any URLStore, so
+// every backend accepts and resolves aliases the same way.
+type ValidatingURLStore struct {
+	URLStore
+	policy AliasPolicy
+}
+
+func NewValidatingURLStore(next URLStore, policy AliasPolicy) *ValidatingURLStore {
+	return &ValidatingURLStore{URLStore: next, policy: policy}
+}
+
+func (s *ValidatingURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
+	if opts.Alias != "" {
+		alias, err := s.policy.Normalize(opts.Alias)
+		if err != nil {
+			return "", false, err
+		}
+		opts.Alias = alias
+	}
+
+	return s.URLStore.SetWithOptions(ctx, url, opts)
+}
+
+// Get resolves code exactly first, since generated codes are case-sensitive,
+// then falls back to the alias it folds to, so "/r/MyLink" finds the alias
+// "mylink".
+func (s *ValidatingURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := s.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+// Resolve resolves code like Get does, returning the entry under its
+// stored code, so a visit to "/r/MyLink" is counted against "mylink".
+func (s *ValidatingURLStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	entry, err := s.URLStore.Resolve(ctx, code)
+	if err != ErrCodeNotFound {
+		return entry, err
+	}
+
+	alias, err := s.lookupAlias(ctx, code)
+	if err != nil {
+		return URLEntry{}, err
+	}
+
+	return s.URLStore.Resolve(ctx, alias.Code)
+}
+
+// Lookup resolves code like Get does. The returned entry's Code is the
+// stored form, which callers should use from then on.
+func (s *ValidatingURLStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	entry, err := s.URLStore.Lookup(ctx, code)
+	if err != ErrCodeNotFound {
+		return entry, err
+	}
+
+	return s.lookupAlias(ctx, code)
+}
+
+func (s *ValidatingURLStore) Update(ctx context.Context, code, url, userID string) error {
+	err := s.URLStore.Update(ctx, code, url, userID)
+	if err != ErrCodeNotFound {
+		return err
+	}
+
+	entry, err := s.lookupAlias(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	return s.URLStore.Update(ctx, entry.Code, url, userID)
+}
+
+func (s *ValidatingURLStore) Delete(ctx context.Context, code, userID string) error {
+	err := s.URLStore.Delete(ctx, code, userID)
+	if err != ErrCodeNotFound {
+		return err
+	}
+
+	entry, err := s.lookupAlias(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	return s.URLStore.Delete(ctx, entry.Code, userID)
+}
+
+// lookupAlias finds the alias that code, which did not match exactly,
+// folds to. Only codes the policy would accept as an alias are folded, and
+// only links created as aliases match, so a visit to "ABC123" can never
+// reach a generated code "abc123".
+func (s *ValidatingURLStore) lookupAlias(ctx context.Context, code string) (URLEntry, error) {
+	folded, err := s.policy.Normalize(code)
+	if err != nil || folded == code {
+		return URLEntry{}, ErrCodeNotFound
+	}
+
+	entry, err := s.URLStore.Lookup(ctx, folded)
+	if err == nil && !entry.Alias {
+		return URLEntry{}, ErrCodeNotFound
+	}
+
+	return entry, err
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAliasPolicy_Normalize(t *testing.T) {
+	tests := []struct {
+		alias string
+		want  string
+		err   error
+	}{
+		{alias: "mylink", want: "mylink"},
+		{alias: "MyLink2024", want: "mylink2024"},
+		{alias: "ab", err: ErrInvalidAlias},
+		{alias: strings.Repeat("a", 21), err: ErrInvalidAlias},
+		{alias: "my-link", err: ErrInvalidAlias},
+		{alias: "a/b/c", err: ErrInvalidAlias},
+		{alias: "café", err: ErrInvalidAlias},
+		{alias: "api", err: ErrReservedAlias},
+		{alias: "Admin", err: ErrReservedAlias},
+		{alias: "adm1n", err: ErrReservedAlias},
+		{alias: "d0cs", err: ErrReservedAlias},
+		{alias: "dосs", err: ErrReservedAlias}, // Cyrillic о and с
+		{alias: "ａｐｉ", err: ErrReservedAlias},  // fullwidth "api"
+	}
+
+	for _, tt := range tests {
+		got, err := DefaultAliasPolicy.Normalize(tt.alias)
+		if err != tt.err {
+			t.Errorf("Normalize(%q): expected error %v, got %v", tt.alias, tt.err, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Normalize(%q): expected %q, got %q", tt.alias, tt.want, got)
+		}
+	}
+}
+
+func TestInMemoryURLStore_AliasPolicy(t *testing.T) {
+	testAliasConformance(t, NewValidatingURLStore(NewInMemoryURLStore(), DefaultAliasPolicy))
+}
+
+// testAliasConformance checks that a store wrapped in the default alias
+// policy rejects bad aliases and resolves good ones case-insensitively.
+func testAliasConformance(t *testing.T, store URLStore) {
+	t.Helper()
+
+	for _, alias := range []string{"ab", "my-link", "a/b/c", "API", "adm1n"} {
+		if _, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{Alias: alias}); err != ErrInvalidAlias && err != ErrReservedAlias {
+			t.Errorf("Expected alias %q to be rejected, got %v", alias, err)
+		}
+	}
+
+	alias := fmt.Sprintf("Conf%d", time.Now().UnixNano()%1e12)
+	code, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{Alias: alias, UserID: "conformance"})
+	if err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Delete(context.Background(), code, "conformance")
+	})
+
+	if code != strings.ToLower(alias) {
+		t.Errorf("Expected stored code %q, got %q", strings.ToLower(alias), code)
+	}
+
+	for _, visit := range []string{alias, code, strings.ToUpper(alias)} {
+		if url, err := store.Get(context.Background(), visit); err != nil || url != "https://example.com" {
+			t.Errorf("Get(%q): expected https://example.com, got %q (%v)", visit, url, err)
+		}
+	}
+
+	if _, _, err := store.SetWithOptions(context.Background(), "https://example.org", SetOptions{Alias: strings.ToUpper(alias)}); err != ErrAliasInUse {
+		t.Errorf("Expected ErrAliasInUse for a differently cased alias, got %v", err)
+	}
+
+	if err := store.Update(context.Background(), strings.ToUpper(alias), "https://example.net", "conformance"); err != nil {
+		t.Errorf("Update(%q): %v", strings.ToUpper(alias), err)
+	}
+	if entry, err := store.Lookup(context.Background(), alias); err != nil || entry.Code != code || entry.URL != "https://example.net" {
+		t.Errorf("Lookup(%q): expected %s -> https://example.net, got %+v (%v)", alias, code, entry, err)
+	}
+
+	// Generated codes are case-sensitive, even when they look like aliases.
+	generated, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{
+		UserID:    "conformance",
+		Generator: constantGenerator(fmt.Sprintf("gen%d", time.Now().UnixNano()%1e12)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Delete(context.Background(), generated, "conformance")
+	})
+
+	if _, err := store.Get(context.Background(), strings.ToUpper(generated)); err != ErrCodeNotFound {
+		t.Errorf("Get(%q): expected ErrCodeNotFound, got %v", strings.ToUpper(generated), err)
+	}
+	if _, err := store.Lookup(context.Background(), strings.ToUpper(generated)); err != ErrCodeNotFound {
+		t.Errorf("Lookup(%q): expected ErrCodeNotFound, got %v", strings.ToUpper(generated), err)
+	}
+	if err := store.Delete(context.Background(), strings.ToUpper(generated), "conformance"); err != ErrCodeNotFound {
+		t.Errorf("Delete(%q): expected ErrCodeNotFound, got %v", strings.ToUpper(generated), err)
+	}
+}
+
+// constantGenerator always generates the same code.
+type constantGenerator string
+
+func (g constantGenerator) Generate(_ context.Context) (string, error) {
+	return string(g), nil
+}
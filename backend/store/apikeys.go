@@ -0,0 +1,76 @@
+package store
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// apiKeyPrefix marks tokens issued by this service so they are easy to
+// recognise in configs and secret scanners.
+const apiKeyPrefix = "us_"
+
+// APIKey lets non-browser clients act as a user. Only a SHA-256 hash of the
+// token is stored; Prefix keeps the first characters so users can tell
+// their keys apart.
+type APIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"-"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type APIKeyStore interface {
+	CreateAPIKey(key APIKey) error
+	// LookupAPIKey finds the key whose token hashes to hash.
+	LookupAPIKey(hash string) (APIKey, error)
+	ListAPIKeys(userID string) ([]APIKey, error)
+	// RevokeAPIKey deletes the key with id if it belongs to userID.
+	RevokeAPIKey(id, userID string) error
+}
+
+// NewAPIKey generates a key for userID and returns it with the plaintext
+// token, which is shown to the user once and never stored.
+func NewAPIKey(userID, name string) (APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return APIKey{}, "", err
+	}
+
+	token := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	key := APIKey{
+		ID:        hex.EncodeToString(id),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(apiKeyPrefix)+6],
+		Hash:      HashAPIKey(token),
+		CreatedAt: time.Now(),
+	}
+
+	return key, token, nil
+}
+
+// HashAPIKey returns the stored form of a token. Tokens carry 256 bits of
+// randomness, so a fast unsalted hash is sufficient.
+func HashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func sortAPIKeys(keys []APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+}
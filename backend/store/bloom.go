@@ -0,0 +1,280 @@
+package store
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BloomFilter is a fixed-size set that can answer "definitely absent"
+// without false negatives. It is safe for concurrent use.
+type BloomFilter struct {
+	mutex  sync.RWMutex
+	bits   []uint64
+	hashes int
+	count  int
+}
+
+// Bounds on the false-positive rate a filter is sized for. Rates near 1
+// would size the filter to nothing, and rates near 0 to unbounded memory.
+const (
+	minBloomFPRate = 1e-9
+	maxBloomFPRate = 0.5
+)
+
+// NewBloomFilter sizes a filter to hold capacity items with roughly the
+// given false-positive rate, clamped to [minBloomFPRate, maxBloomFPRate].
+func NewBloomFilter(capacity int, fpRate float64) *BloomFilter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	if !(fpRate >= minBloomFPRate) {
+		fpRate = minBloomFPRate
+	} else if fpRate > maxBloomFPRate {
+		fpRate = maxBloomFPRate
+	}
+	m := math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := int(math.Round(m / float64(capacity) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+
+	return &BloomFilter{
+		bits:   make([]uint64, (int(m)+63)/64),
+		hashes: k,
+	}
+}
+
+// locations derives the filter's bit positions for item by double hashing
+// a single 64-bit FNV-1a sum.
+func (f *BloomFilter) locations(item string) []uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32|1
+
+	m := uint64(len(f.bits) * 64)
+	locations := make([]uint64, f.hashes)
+	for i := range locations {
+		locations[i] = (h1 + uint64(i)*h2) % m
+	}
+	return locations
+}
+
+func (f *BloomFilter) Add(item string) {
+	locations := f.locations(item)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, bit := range locations {
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// MayContain reports false only if item was never added.
+func (f *BloomFilter) MayContain(item string) bool {
+	locations := f.locations(item)
+
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for _, bit := range locations {
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// EstimatedFalsePositiveRate is the expected false-positive rate given how
+// many items have been added so far.
+func (f *BloomFilter) EstimatedFalsePositiveRate() float64 {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	m := float64(len(f.bits) * 64)
+	k := float64(f.hashes)
+	return math.Pow(1-math.Exp(-k*float64(f.count)/m), k)
+}
+
+// CodeLister is implemented by stores that can enumerate every stored code.
+type CodeLister interface {
+	EachCode(ctx context.Context, fn func(code string) error) error
+}
+
+// BloomURLStore answers lookups for codes that were never created without
+// consulting the URLStore behind it, so scans of random codes do not reach
+// the database.
+//
+// The filter only learns about codes created through this store or found
+// by Rebuild. When several processes share a database, links created by
+// the others are reported missing until the next rebuild, so it is only
+// suitable for stores that a single process writes to.
+type BloomURLStore struct {
+	URLStore
+	lister CodeLister
+	fpRate float64
+
+	mutex    sync.RWMutex
+	filter   *BloomFilter // nil until the first Rebuild
+	building *BloomFilter
+
+	negatives      atomic.Uint64
+	falsePositives atomic.Uint64
+}
+
+func NewBloomURLStore(next URLStore, lister CodeLister, fpRate float64) *BloomURLStore {
+	return &BloomURLStore{
+		URLStore: next,
+		lister:   lister,
+		fpRate:   fpRate,
+	}
+}
+
+// minBloomCapacity keeps a near-empty store's filter large enough for the
+// links created before the next rebuild.
+const minBloomCapacity = 100000
+
+// Rebuild replaces the filter with one loaded from the store, which also
+// drops codes that have since been deleted.
+func (s *BloomURLStore) Rebuild(ctx context.Context) error {
+	capacity := 2 * s.URLStore.Stats(ctx)
+	if capacity < minBloomCapacity {
+		capacity = minBloomCapacity
+	}
+	filter := NewBloomFilter(capacity, s.fpRate)
+
+	// Codes created while the store is being scanned go into both filters.
+	s.mutex.Lock()
+	s.building = filter
+	s.mutex.Unlock()
+
+	err := s.lister.EachCode(ctx, func(code string) error {
+		filter.Add(code)
+		return nil
+	})
+
+	s.mutex.Lock()
+	s.building = nil
+	if err == nil {
+		s.filter = filter
+	}
+	s.mutex.Unlock()
+
+	return err
+}
+
+// Run rebuilds the filter every interval until ctx is done.
+func (s *BloomURLStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Rebuild(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Error rebuilding code filter: %v", err)
+			}
+		}
+	}
+}
+
+// FilterStats reports how many lookups the filter answered on its own and
+// how many it let through for codes that turned out not to exist.
+func (s *BloomURLStore) FilterStats() (negatives, falsePositives uint64) {
+	return s.negatives.Load(), s.falsePositives.Load()
+}
+
+// EstimatedFalsePositiveRate is the current filter's theoretical rate.
+func (s *BloomURLStore) EstimatedFalsePositiveRate() float64 {
+	s.mutex.RLock()
+	filter := s.filter
+	s.mutex.RUnlock()
+
+	if filter == nil {
+		return 0
+	}
+	return filter.EstimatedFalsePositiveRate()
+}
+
+func (s *BloomURLStore) add(code string) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if s.filter != nil {
+		s.filter.Add(code)
+	}
+	if s.building != nil {
+		s.building.Add(code)
+	}
+}
+
+// absent reports whether code is definitely not stored.
+func (s *BloomURLStore) absent(code string) bool {
+	s.mutex.RLock()
+	filter := s.filter
+	s.mutex.RUnlock()
+
+	if filter == nil || filter.MayContain(code) {
+		return false
+	}
+	s.negatives.Add(1)
+	return true
+}
+
+func (s *BloomURLStore) Set(ctx context.Context, url string) (string, error) {
+	code, err := s.URLStore.Set(ctx, url)
+	if err == nil {
+		s.add(code)
+	}
+
+	return code, err
+}
+
+func (s *BloomURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
+	code, existing, err := s.URLStore.SetWithOptions(ctx, url, opts)
+	if err == nil && !existing {
+		s.add(code)
+	}
+
+	return code, existing, err
+}
+
+func (s *BloomURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := s.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+func (s *BloomURLStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	if s.absent(code) {
+		return URLEntry{}, ErrCodeNotFound
+	}
+
+	entry, err := s.URLStore.Resolve(ctx, code)
+	if err == ErrCodeNotFound {
+		s.falsePositives.Add(1)
+	}
+
+	return entry, err
+}
+
+func (s *BloomURLStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	if s.absent(code) {
+		return URLEntry{}, ErrCodeNotFound
+	}
+
+	entry, err := s.URLStore.Lookup(ctx, code)
+	if err == ErrCodeNotFound {
+		s.falsePositives.Add(1)
+	}
+
+	return entry, err
+}
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 1000; i++ {
+		filter.Add(fmt.Sprintf("code%d", i))
+	}
+
+	for i := 0; i < 1000; i++ {
+		if !filter.MayContain(fmt.Sprintf("code%d", i)) {
+			t.Fatalf("False negative for code%d", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("other%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.03 {
+		t.Errorf("Expected a false-positive rate near 1%%, got %.2f%%", rate*100)
+	}
+	if rate := filter.EstimatedFalsePositiveRate(); rate < 0.005 || rate > 0.02 {
+		t.Errorf("Expected an estimated rate near 1%%, got %.2f%%", rate*100)
+	}
+}
+
+func TestBloomFilter_ClampsRate(t *testing.T) {
+	for _, rate := range []float64{-1, 0, 1, 2, math.NaN()} {
+		filter := NewBloomFilter(100, rate)
+		filter.Add("code")
+		if !filter.MayContain("code") {
+			t.Errorf("Rate %v: false negative", rate)
+		}
+	}
+}
+
+func TestBloomURLStore(t *testing.T) {
+	ctx := context.Background()
+	memory := NewInMemoryURLStore()
+	existing, err := memory.Set(ctx, "https://example.com")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	backend := &countingStore{URLStore: memory}
+	bloom := NewBloomURLStore(backend, memory, 0.01)
+	if err := bloom.Rebuild(ctx); err != nil {
+		t.Fatalf("Failed to rebuild filter: %v", err)
+	}
+
+	// Unknown codes are rejected without reaching the store
+	for i := 0; i < 100; i++ {
+		if _, err := bloom.Get(ctx, fmt.Sprintf("scan%d", i)); err != ErrCodeNotFound {
+			t.Fatalf("Expected ErrCodeNotFound, got %v", err)
+		}
+	}
+	negatives, falsePositives := bloom.FilterStats()
+	if backend.lookups != int(falsePositives) || negatives+falsePositives != 100 {
+		t.Errorf("Expected only false positives to reach the store, got %d lookups, %d negatives, %d false positives",
+			backend.lookups, negatives, falsePositives)
+	}
+
+	// Codes loaded at startup and created afterwards both resolve
+	created, _, err := bloom.SetWithOptions(ctx, "https://example.org", SetOptions{Alias: "mylink"})
+	if err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	for _, code := range []string{existing, created} {
+		if _, err := bloom.Lookup(ctx, code); err != nil {
+			t.Errorf("Expected %s to resolve, got %v", code, err)
+		}
+	}
+
+	// Codes created behind the filter's back are found after a rebuild
+	direct, err := memory.Set(ctx, "https://example.net")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	if err := bloom.Rebuild(ctx); err != nil {
+		t.Fatalf("Failed to rebuild filter: %v", err)
+	}
+	if _, err := bloom.Get(ctx, direct); err != nil {
+		t.Errorf("Expected %s to resolve after rebuild, got %v", direct, err)
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltAPIKey is the on-disk form of an APIKey. APIKey hides the owner and
+// hash from JSON responses, so it cannot be marshalled directly.
+type boltAPIKey struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// forEachAPIKey calls fn for every stored key. Listing and revoking scan the
+// whole bucket, which is fine for the handful of keys a small deployment
+// holds.
+func forEachAPIKey(tx *bolt.Tx, fn func(key APIKey) error) error {
+	return tx.Bucket(apiKeysBucket).ForEach(func(_, data []byte) error {
+		var stored boltAPIKey
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		return fn(APIKey(stored))
+	})
+}
+
+func (s *BoltURLStore) CreateAPIKey(key APIKey) error {
+	data, err := json.Marshal(boltAPIKey(key))
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(apiKeysBucket).Put([]byte(key.Hash), data)
+	})
+}
+
+func (s *BoltURLStore) LookupAPIKey(hash string) (APIKey, error) {
+	var key APIKey
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(apiKeysBucket).Get([]byte(hash))
+		if data == nil {
+			return ErrAPIKeyNotFound
+		}
+
+		var stored boltAPIKey
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		key = APIKey(stored)
+		return nil
+	})
+
+	return key, err
+}
+
+func (s *BoltURLStore) ListAPIKeys(userID string) ([]APIKey, error) {
+	keys := []APIKey{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachAPIKey(tx, func(key APIKey) error {
+			if key.UserID == userID {
+				keys = append(keys, key)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortAPIKeys(keys)
+
+	return keys, nil
+}
+
+func (s *BoltURLStore) RevokeAPIKey(id, userID string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		var found *APIKey
+		err := forEachAPIKey(tx, func(key APIKey) error {
+			if key.ID == id {
+				found = &key
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if found == nil {
+			return ErrAPIKeyNotFound
+		}
+		if found.UserID != userID {
+			return ErrNotOwner
+		}
+
+		return tx.Bucket(apiKeysBucket).Delete([]byte(found.Hash))
+	})
+}
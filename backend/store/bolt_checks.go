@@ -0,0 +1,92 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltCheckStore keeps link checks in the checks bucket of a BoltURLStore
+// file, keyed like clicks by code NUL timestamp sequence.
+type BoltCheckStore struct {
+	db *bolt.DB
+}
+
+func (s *BoltURLStore) CheckStore() *BoltCheckStore {
+	return &BoltCheckStore{db: s.db}
+}
+
+func (s *BoltCheckStore) RecordCheck(check LinkCheck) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(checksBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		prefix := clickKeyPrefix(check.Code)
+		key := append([]byte(nil), prefix...)
+		key = binary.BigEndian.AppendUint64(key, uint64(check.CheckedAt.UnixNano()))
+		key = binary.BigEndian.AppendUint64(key, seq)
+
+		data, err := json.Marshal(check)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put(key, data); err != nil {
+			return err
+		}
+
+		// Drop the oldest checks beyond the retained history.
+		cursor := bucket.Cursor()
+		count := 0
+		for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Next() {
+			count++
+		}
+		for ; count > MaxCheckHistory; count-- {
+			cursor.Seek(prefix)
+			if err := cursor.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltCheckStore) CheckHistory(code string, limit int) ([]LinkCheck, error) {
+	history := []LinkCheck{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := clickKeyPrefix(code)
+		cursor := tx.Bucket(checksBucket).Cursor()
+
+		// Start from the last key with the prefix and walk backwards.
+		key, data := cursor.Seek(append([]byte(code), 1))
+		if key == nil {
+			key, data = cursor.Last()
+		} else {
+			key, data = cursor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix) && len(history) < limit; key, data = cursor.Prev() {
+			var check LinkCheck
+			if err := json.Unmarshal(data, &check); err != nil {
+				return err
+			}
+			check.Code = code
+			history = append(history, check)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (s *BoltCheckStore) DeleteChecks(code string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteBoltPrefix(tx.Bucket(checksBucket), clickKeyPrefix(code))
+	})
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltClickStore keeps clicks in the clicks bucket of a BoltURLStore file,
+// keyed by code NUL timestamp sequence so each link's clicks are contiguous.
+type BoltClickStore struct {
+	db *bolt.DB
+}
+
+func (s *BoltURLStore) ClickStore() *BoltClickStore {
+	return &BoltClickStore{db: s.db}
+}
+
+func clickKeyPrefix(code string) []byte {
+	return append([]byte(code), 0)
+}
+
+func (s *BoltClickStore) RecordClicks(clicks []Click) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(clicksBucket)
+		for _, click := range clicks {
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			key := clickKeyPrefix(click.Code)
+			key = binary.BigEndian.AppendUint64(key, uint64(click.Timestamp.UnixNano()))
+			key = binary.BigEndian.AppendUint64(key, seq)
+
+			data, err := json.Marshal(click)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltClickStore) DeleteClicks(code string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return deleteBoltPrefix(tx.Bucket(clicksBucket), clickKeyPrefix(code))
+	})
+}
+
+// deleteBoltPrefix deletes every key in bucket that starts with prefix.
+func deleteBoltPrefix(bucket *bolt.Bucket, prefix []byte) error {
+	cursor := bucket.Cursor()
+	for key, _ := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Seek(prefix) {
+		if err := cursor.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BoltClickStore) ClickStats(code string, since time.Time, topReferrers int) (ClickStats, error) {
+	var clicks []Click
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := clickKeyPrefix(code)
+		cursor := tx.Bucket(clicksBucket).Cursor()
+		for key, data := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, data = cursor.Next() {
+			var click Click
+			if err := json.Unmarshal(data, &click); err != nil {
+				return err
+			}
+			clicks = append(clicks, click)
+		}
+		return nil
+	})
+	if err != nil {
+		return ClickStats{}, err
+	}
+
+	return aggregateClicks(code, clicks, since, topReferrers), nil
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	jobsBucket     = []byte("url_jobs")
+	deadJobsBucket = []byte("dead_url_jobs")
+)
+
+// BoltJobQueue keeps jobs in a bbolt file, keyed by ID, and dead letters
+// keyed by failure time and ID. A bbolt file is locked by the process that
+// opens it, so the queue is only shared by that process's workers.
+type BoltJobQueue struct {
+	db *bolt.DB
+	// owned is set when the queue opened its own file and Close should
+	// close it.
+	owned bool
+}
+
+// JobQueue returns a JobQueue kept in the file of the URL store.
+func (s *BoltURLStore) JobQueue() *BoltJobQueue {
+	return &BoltJobQueue{db: s.db}
+}
+
+// OpenBoltJobQueue opens a JobQueue in its own file, for URL stores that
+// have no file to keep it in.
+func OpenBoltJobQueue(path string) (*BoltJobQueue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{jobsBucket, deadJobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", path, err)
+	}
+
+	return &BoltJobQueue{db: db, owned: true}, nil
+}
+
+// Close closes the file of a queue opened with OpenBoltJobQueue. A queue
+// from BoltURLStore.JobQueue is closed with the store.
+func (q *BoltJobQueue) Close() error {
+	if !q.owned {
+		return nil
+	}
+	return q.db.Close()
+}
+
+// view and update run fn in a bbolt transaction, checking ctx only before
+// it starts as BoltURLStore does.
+func (q *BoltJobQueue) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.db.View(fn)
+}
+
+func (q *BoltJobQueue) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return q.db.Update(fn)
+}
+
+func jobKey(id int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(id))
+}
+
+func putBoltJob(bucket *bolt.Bucket, key []byte, job any) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, data)
+}
+
+// forEachBoltJob calls fn with every queued job.
+func forEachBoltJob(tx *bolt.Tx, fn func(job Job) error) error {
+	return tx.Bucket(jobsBucket).ForEach(func(_, data []byte) error {
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+		return fn(job)
+	})
+}
+
+func (q *BoltJobQueue) Enqueue(ctx context.Context, code, url string) (bool, error) {
+	queued := false
+	err := q.update(ctx, func(tx *bolt.Tx) error {
+		duplicate := false
+		err := forEachBoltJob(tx, func(job Job) error {
+			duplicate = duplicate || (job.Code == code && job.URL == url)
+			return nil
+		})
+		if err != nil || duplicate {
+			return err
+		}
+
+		bucket := tx.Bucket(jobsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		job := Job{ID: int64(seq), Code: code, URL: url, AvailableAt: now, CreatedAt: now}
+		queued = true
+		return putBoltJob(bucket, jobKey(job.ID), job)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return queued, nil
+}
+
+func (q *BoltJobQueue) Lease(ctx context.Context, worker string, now time.Time, visibility time.Duration, limit int) ([]Job, error) {
+	leased := []Job{}
+	err := q.update(ctx, func(tx *bolt.Tx) error {
+		available := []Job{}
+		err := forEachBoltJob(tx, func(job Job) error {
+			if !job.AvailableAt.After(now) {
+				available = append(available, job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(available, func(i, j int) bool {
+			if !available[i].AvailableAt.Equal(available[j].AvailableAt) {
+				return available[i].AvailableAt.Before(available[j].AvailableAt)
+			}
+			return available[i].ID < available[j].ID
+		})
+		if len(available) > limit {
+			available = available[:limit]
+		}
+
+		bucket := tx.Bucket(jobsBucket)
+		for _, job := range available {
+			job.Attempts++
+			job.LeasedBy = worker
+			job.AvailableAt = now.Add(visibility)
+			if err := putBoltJob(bucket, jobKey(job.ID), job); err != nil {
+				return err
+			}
+			leased = append(leased, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return leased, nil
+}
+
+// settle runs fn with the queue's copy of job, if job still holds its
+// lease.
+func (q *BoltJobQueue) settle(ctx context.Context, job Job, fn func(tx *bolt.Tx, stored Job) error) error {
+	return q.update(ctx, func(tx *bolt.Tx) error {
+		data := tx.Bucket(jobsBucket).Get(jobKey(job.ID))
+		if data == nil {
+			return ErrLeaseLost
+		}
+
+		var stored Job
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return err
+		}
+		if !leasedBy(stored, job) {
+			return ErrLeaseLost
+		}
+
+		return fn(tx, stored)
+	})
+}
+
+func (q *BoltJobQueue) Complete(ctx context.Context, job Job) error {
+	return q.settle(ctx, job, func(tx *bolt.Tx, stored Job) error {
+		return tx.Bucket(jobsBucket).Delete(jobKey(stored.ID))
+	})
+}
+
+func (q *BoltJobQueue) Retry(ctx context.Context, job Job, availableAt time.Time, reason string) error {
+	return q.settle(ctx, job, func(tx *bolt.Tx, stored Job) error {
+		stored.LeasedBy = ""
+		stored.AvailableAt = availableAt
+		stored.LastError = reason
+		return putBoltJob(tx.Bucket(jobsBucket), jobKey(stored.ID), stored)
+	})
+}
+
+func (q *BoltJobQueue) Release(ctx context.Context, job Job) error {
+	return q.settle(ctx, job, func(tx *bolt.Tx, stored Job) error {
+		stored.Attempts--
+		stored.LeasedBy = ""
+		stored.AvailableAt = time.Now()
+		return putBoltJob(tx.Bucket(jobsBucket), jobKey(stored.ID), stored)
+	})
+}
+
+func (q *BoltJobQueue) DeadLetter(ctx context.Context, job Job, now time.Time, reason string) error {
+	return q.settle(ctx, job, func(tx *bolt.Tx, stored Job) error {
+		if err := tx.Bucket(jobsBucket).Delete(jobKey(stored.ID)); err != nil {
+			return err
+		}
+
+		stored.LeasedBy = ""
+		stored.AvailableAt = now
+		stored.LastError = reason
+		key := binary.BigEndian.AppendUint64(nil, uint64(now.UnixNano()))
+		key = append(key, jobKey(stored.ID)...)
+		return putBoltJob(tx.Bucket(deadJobsBucket), key, DeadJob{Job: stored, FailedAt: now})
+	})
+}
+
+func (q *BoltJobQueue) DeadLetters(ctx context.Context, limit int) ([]DeadJob, error) {
+	dead := []DeadJob{}
+	err := q.view(ctx, func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(deadJobsBucket).Cursor()
+		for key, data := cursor.Last(); key != nil && len(dead) < limit; key, data = cursor.Prev() {
+			var job DeadJob
+			if err := json.Unmarshal(data, &job); err != nil {
+				return err
+			}
+			dead = append(dead, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dead, nil
+}
+
+func (q *BoltJobQueue) JobStats(ctx context.Context, now time.Time) (JobQueueStats, error) {
+	var stats JobQueueStats
+	err := q.view(ctx, func(tx *bolt.Tx) error {
+		stats.Dead = tx.Bucket(deadJobsBucket).Stats().KeyN
+		return forEachBoltJob(tx, func(job Job) error {
+			if job.LeasedBy != "" && job.AvailableAt.After(now) {
+				stats.Leased++
+			} else {
+				stats.Queued++
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return JobQueueStats{}, err
+	}
+
+	return stats, nil
+}
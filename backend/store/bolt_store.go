@@ -0,0 +1,497 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	urlsBucket     = []byte("urls")
+	userURLsBucket = []byte("user_urls")
+	clicksBucket   = []byte("clicks")
+	apiKeysBucket  = []byte("api_keys")
+	urlKeysBucket  = []byte("url_keys")
+	checksBucket   = []byte("checks")
+)
+
+// BoltURLStore keeps links in a single bbolt database file, giving small
+// deployments durability without running PostgreSQL.
+//
+// The user_urls bucket indexes links by owner with keys of the form
+// userID NUL created-at NUL code, so a prefix scan yields a user's links
+// in creation order. The url_keys bucket maps userID NUL URLKey to the code
+// of the user's deduplicated link for that URL.
+type BoltURLStore struct {
+	db *bolt.DB
+}
+
+func NewBoltURLStore(dataDir string) (*BoltURLStore, error) {
+	if err := os.MkdirAll(dataDir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+
+	path := filepath.Join(dataDir, "urls.db")
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{urlsBucket, userURLsBucket, clicksBucket, apiKeysBucket, urlKeysBucket, checksBucket, jobsBucket, deadJobsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", path, err)
+	}
+
+	return &BoltURLStore{db: db}, nil
+}
+
+func (s *BoltURLStore) Close() error {
+	return s.db.Close()
+}
+
+// view and update run fn in a bbolt transaction. Transactions cannot be
+// interrupted, so ctx is only checked before fn starts.
+func (s *BoltURLStore) view(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.View(fn)
+}
+
+func (s *BoltURLStore) update(ctx context.Context, fn func(tx *bolt.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.Update(fn)
+}
+
+func userURLKey(entry URLEntry) []byte {
+	key := make([]byte, 0, len(entry.UserID)+len(entry.Code)+10)
+	key = append(key, entry.UserID...)
+	key = append(key, 0)
+	key = binary.BigEndian.AppendUint64(key, uint64(entry.CreatedAt.UnixNano()))
+	key = append(key, 0)
+	key = append(key, entry.Code...)
+	return key
+}
+
+func getBoltEntry(tx *bolt.Tx, code string) (URLEntry, error) {
+	data := tx.Bucket(urlsBucket).Get([]byte(code))
+	if data == nil {
+		return URLEntry{}, ErrCodeNotFound
+	}
+
+	var entry URLEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return URLEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func putBoltEntry(tx *bolt.Tx, entry URLEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(urlsBucket).Put([]byte(entry.Code), data)
+}
+
+func deleteBoltEntry(tx *bolt.Tx, entry URLEntry) error {
+	if err := tx.Bucket(urlsBucket).Delete([]byte(entry.Code)); err != nil {
+		return err
+	}
+	if err := forgetBoltDedupe(tx, entry); err != nil {
+		return err
+	}
+
+	return tx.Bucket(userURLsBucket).Delete(userURLKey(entry))
+}
+
+// forgetBoltDedupe drops entry from the url_keys bucket if it is registered
+// there.
+func forgetBoltDedupe(tx *bolt.Tx, entry URLEntry) error {
+	bucket := tx.Bucket(urlKeysBucket)
+	key := []byte(userDedupeKey(entry.UserID, URLKey(entry.URL)))
+	if string(bucket.Get(key)) != entry.Code {
+		return nil
+	}
+
+	return bucket.Delete(key)
+}
+
+func (s *BoltURLStore) Set(ctx context.Context, url string) (string, error) {
+	code, _, err := s.SetWithOptions(ctx, url, SetOptions{})
+	return code, err
+}
+
+func (s *BoltURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
+	if url == "" {
+		return "", false, ErrInvalidURL
+	}
+
+	userID := opts.UserID
+	if userID == "" {
+		userID = "anonymous"
+	}
+
+	entry := URLEntry{
+		URL:       url,
+		UserID:    userID,
+		CreatedAt: time.Now(),
+		Alias:     opts.Alias != "",
+	}
+	if !opts.ExpiresAt.IsZero() {
+		expiresAt := opts.ExpiresAt
+		entry.ExpiresAt = &expiresAt
+	}
+	if opts.MaxClicks > 0 {
+		remaining := opts.MaxClicks
+		entry.ClicksRemaining = &remaining
+	}
+
+	if opts.Alias != "" {
+		entry.Code = opts.Alias
+		_, inserted, err := s.insertEntry(ctx, entry, nil)
+		if err != nil {
+			return "", false, err
+		}
+		if !inserted {
+			return "", false, ErrAliasInUse
+		}
+
+		return entry.Code, false, nil
+	}
+
+	var dedupeKey []byte
+	if key := opts.dedupeKey(url); key != "" {
+		dedupeKey = []byte(userDedupeKey(userID, key))
+
+		// Checking first saves generating, and possibly sequencing, a code
+		// that would not be used.
+		var existing string
+		err := s.view(ctx, func(tx *bolt.Tx) error {
+			existing = string(tx.Bucket(urlKeysBucket).Get(dedupeKey))
+			return nil
+		})
+		if err != nil {
+			return "", false, err
+		}
+		if existing != "" {
+			return existing, true, nil
+		}
+	}
+
+	// Codes are generated outside the write transaction, because generators
+	// backed by NextSequence need a transaction of their own.
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, err := generateCode(ctx, opts.Generator)
+		if err != nil {
+			return "", false, err
+		}
+
+		entry.Code = code
+		existing, inserted, err := s.insertEntry(ctx, entry, dedupeKey)
+		if err != nil {
+			return "", false, err
+		}
+		if existing != "" {
+			return existing, true, nil
+		}
+		if inserted {
+			return code, false, nil
+		}
+	}
+
+	return "", false, ErrCodeSpaceExhausted
+}
+
+// insertEntry stores entry unless its code is already taken, reporting
+// whether it was inserted. If dedupeKey is set, the entry is registered
+// under it, unless another link already is, in which case that link's code
+// is returned instead.
+func (s *BoltURLStore) insertEntry(ctx context.Context, entry URLEntry, dedupeKey []byte) (existing string, inserted bool, err error) {
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		if dedupeKey != nil {
+			if code := tx.Bucket(urlKeysBucket).Get(dedupeKey); code != nil {
+				existing = string(code)
+				return nil
+			}
+		}
+		if tx.Bucket(urlsBucket).Get([]byte(entry.Code)) != nil {
+			return nil
+		}
+		if err := putBoltEntry(tx, entry); err != nil {
+			return err
+		}
+		inserted = true
+
+		if dedupeKey != nil {
+			if err := tx.Bucket(urlKeysBucket).Put(dedupeKey, []byte(entry.Code)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(userURLsBucket).Put(userURLKey(entry), nil)
+	})
+
+	return existing, inserted, err
+}
+
+func (s *BoltURLStore) NextSequence(ctx context.Context) (uint64, error) {
+	var n uint64
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		var err error
+		n, err = tx.Bucket(urlsBucket).NextSequence()
+		return err
+	})
+
+	return n, err
+}
+
+func (s *BoltURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := s.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+func (s *BoltURLStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	entry, err := s.Lookup(ctx, code)
+	if err != nil {
+		return URLEntry{}, err
+	}
+	if entry.Expired(time.Now()) {
+		return URLEntry{}, ErrCodeExpired
+	}
+	if entry.ClicksRemaining == nil {
+		return entry, nil
+	}
+
+	// bbolt serializes write transactions, so re-reading and decrementing
+	// inside one cannot overspend the click limit.
+	err = s.update(ctx, func(tx *bolt.Tx) error {
+		entry, err = getBoltEntry(tx, code)
+		if err != nil {
+			return err
+		}
+		if entry.Expired(time.Now()) {
+			return ErrCodeExpired
+		}
+		if *entry.ClicksRemaining <= 0 {
+			return ErrClicksExhausted
+		}
+
+		remaining := *entry.ClicksRemaining - 1
+		entry.ClicksRemaining = &remaining
+
+		return putBoltEntry(tx, entry)
+	})
+	if err != nil {
+		return URLEntry{}, err
+	}
+
+	return entry, nil
+}
+
+func (s *BoltURLStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	var entry URLEntry
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getBoltEntry(tx, code)
+		return err
+	})
+
+	return entry, err
+}
+
+func (s *BoltURLStore) GetByUser(ctx context.Context, userID string) ([]URLEntry, error) {
+	entries := []URLEntry{}
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		prefix := append([]byte(userID), 0)
+		cursor := tx.Bucket(userURLsBucket).Cursor()
+
+		// Walk the user's keys backwards from just past the prefix range, so
+		// the newest link comes first.
+		key, _ := cursor.Seek(append([]byte(userID), 1))
+		if key == nil {
+			key, _ = cursor.Last()
+		} else {
+			key, _ = cursor.Prev()
+		}
+		for ; key != nil && bytes.HasPrefix(key, prefix); key, _ = cursor.Prev() {
+			code := key[len(prefix)+9:]
+			entry, err := getBoltEntry(tx, string(code))
+			if err == ErrCodeNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (s *BoltURLStore) Update(ctx context.Context, code, url, userID string) error {
+	if url == "" {
+		return ErrInvalidURL
+	}
+
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		entry, err := getBoltEntry(tx, code)
+		if err != nil {
+			return err
+		}
+		if entry.UserID != userID {
+			return ErrNotOwner
+		}
+
+		// The link no longer points at the URL it was deduplicated under.
+		if err := forgetBoltDedupe(tx, entry); err != nil {
+			return err
+		}
+		entry.URL = url
+		entry.Metadata = nil
+		return putBoltEntry(tx, entry)
+	})
+}
+
+func (s *BoltURLStore) SetMetadata(ctx context.Context, code, url string, meta LinkMetadata) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		entry, err := getBoltEntry(tx, code)
+		if err != nil {
+			return err
+		}
+		if entry.URL != url {
+			return nil
+		}
+
+		entry.Metadata = &meta
+		return putBoltEntry(tx, entry)
+	})
+}
+
+func (s *BoltURLStore) DueForCheck(ctx context.Context, now time.Time, limit int) ([]URLEntry, error) {
+	var due []URLEntry
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(_, data []byte) error {
+			var entry URLEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			if !entry.checkDue().After(now) {
+				due = append(due, entry)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dueEntries(due, now, limit), nil
+}
+
+func (s *BoltURLStore) Delete(ctx context.Context, code, userID string) error {
+	return s.update(ctx, func(tx *bolt.Tx) error {
+		entry, err := getBoltEntry(tx, code)
+		if err != nil {
+			return err
+		}
+		if entry.UserID != userID {
+			return ErrNotOwner
+		}
+
+		if err := deleteBoltEntry(tx, entry); err != nil {
+			return err
+		}
+		if err := deleteBoltPrefix(tx.Bucket(clicksBucket), clickKeyPrefix(code)); err != nil {
+			return err
+		}
+		return deleteBoltPrefix(tx.Bucket(checksBucket), clickKeyPrefix(code))
+	})
+}
+
+func (s *BoltURLStore) PurgeExpired(ctx context.Context) (int, error) {
+	removed := 0
+	err := s.update(ctx, func(tx *bolt.Tx) error {
+		now := time.Now()
+
+		var expired []URLEntry
+		err := tx.Bucket(urlsBucket).ForEach(func(_, data []byte) error {
+			var entry URLEntry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				return err
+			}
+			if entry.Expired(now) {
+				expired = append(expired, entry)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// The clicks and checks go too, or whoever next claims an expired
+		// alias would inherit them.
+		for _, entry := range expired {
+			if err := deleteBoltEntry(tx, entry); err != nil {
+				return err
+			}
+			if err := deleteBoltPrefix(tx.Bucket(clicksBucket), clickKeyPrefix(entry.Code)); err != nil {
+				return err
+			}
+			if err := deleteBoltPrefix(tx.Bucket(checksBucket), clickKeyPrefix(entry.Code)); err != nil {
+				return err
+			}
+		}
+		removed = len(expired)
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func (s *BoltURLStore) EachCode(ctx context.Context, fn func(code string) error) error {
+	return s.view(ctx, func(tx *bolt.Tx) error {
+		return tx.Bucket(urlsBucket).ForEach(func(code, _ []byte) error {
+			return fn(string(code))
+		})
+	})
+}
+
+func (s *BoltURLStore) Stats(ctx context.Context) int {
+	count := 0
+	err := s.view(ctx, func(tx *bolt.Tx) error {
+		count = tx.Bucket(urlsBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error getting stats: %v", err)
+		return 0
+	}
+
+	return count
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func newTestBoltStore(t *testing.T, dataDir string) *BoltURLStore {
+	t.Helper()
+
+	store, err := NewBoltURLStore(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	return store
+}
+
+func TestBoltURLStore_Persistence(t *testing.T) {
+	dataDir := t.TempDir()
+	store := newTestBoltStore(t, dataDir)
+
+	code, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{UserID: "user1"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	if _, _, err := store.SetWithOptions(context.Background(), "https://example.org", SetOptions{Alias: code}); err != ErrAliasInUse {
+		t.Errorf("Expected ErrAliasInUse, got %v", err)
+	}
+	store.Close()
+
+	// Links survive reopening the file
+	store = newTestBoltStore(t, dataDir)
+
+	url, err := store.Get(context.Background(), code)
+	if err != nil {
+		t.Fatalf("Failed to get URL after reopen: %v", err)
+	}
+	if url != "https://example.com" {
+		t.Errorf("Expected https://example.com, got %s", url)
+	}
+
+	entries, err := store.GetByUser(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Code != code {
+		t.Errorf("Expected %s in user URLs, got %v", code, entries)
+	}
+
+	if err := store.Delete(context.Background(), code, "user1"); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if stats := store.Stats(context.Background()); stats != 0 {
+		t.Errorf("Expected 0 URLs after delete, got %d", stats)
+	}
+}
+
+func TestBoltURLStore_Expiry(t *testing.T) {
+	store := newTestBoltStore(t, t.TempDir())
+
+	code, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{ExpiresAt: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	if _, err := store.Get(context.Background(), code); err != ErrCodeExpired {
+		t.Errorf("Expected ErrCodeExpired, got %v", err)
+	}
+
+	if removed, err := store.PurgeExpired(context.Background()); err != nil || removed != 1 {
+		t.Errorf("Expected 1 purged URL, got %d (%v)", removed, err)
+	}
+}
+
+func TestBoltURLStore_PurgeForgetsHistory(t *testing.T) {
+	store := newTestBoltStore(t, t.TempDir())
+	testPurgeForgetsHistory(t, store, store.ClickStore(), store.CheckStore())
+}
+
+func TestBoltURLStore_AliasPolicy(t *testing.T) {
+	testAliasConformance(t, NewValidatingURLStore(newTestBoltStore(t, t.TempDir()), DefaultAliasPolicy))
+}
+
+func TestBoltURLStore_CancelledContext(t *testing.T) {
+	store := newTestBoltStore(t, t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.Set(ctx, "https://example.com"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from Set, got %v", err)
+	}
+	if _, err := store.Get(ctx, "missing"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from Get, got %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CachingURLStore keeps recently resolved links in a bounded LRU in front of
+// another URLStore, so popular redirects skip the database. Missing codes
+// are cached too, for a shorter time, so repeated probes for the same code
+// are cheap.
+//
+// Writes made through the cache invalidate it. Writes made by other
+// processes sharing the backend are only seen once cached items expire, so
+// the TTL bounds how stale a redirect can be. Links with a click limit are
+// never cached, since every visit has to reach the store.
+type CachingURLStore struct {
+	URLStore
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+
+	mutex sync.Mutex
+	items map[string]*list.Element
+	order *list.List // front is most recently used
+	// generation changes on every invalidation, so a load that raced with
+	// a write does not put the old entry back.
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheItem struct {
+	code    string
+	entry   URLEntry
+	missing bool
+	expires time.Time
+}
+
+// NewCachingURLStore caches up to size codes from next. Found entries live
+// for ttl and missing codes for negativeTTL; a zero negativeTTL disables
+// negative caching.
+func NewCachingURLStore(next URLStore, size int, ttl, negativeTTL time.Duration) *CachingURLStore {
+	return &CachingURLStore{
+		URLStore:    next,
+		size:        size,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		items:       make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// CacheStats reports how many lookups were served from the cache and how
+// many went to the underlying store.
+func (c *CachingURLStore) CacheStats() (hits, misses uint64) {
+	return c.hits.Load(), c.misses.Load()
+}
+
+// Len returns the number of cached codes.
+func (c *CachingURLStore) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *CachingURLStore) Set(ctx context.Context, url string) (string, error) {
+	code, err := c.URLStore.Set(ctx, url)
+	if err == nil {
+		c.invalidate(code)
+	}
+
+	return code, err
+}
+
+func (c *CachingURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
+	code, existing, err := c.URLStore.SetWithOptions(ctx, url, opts)
+	if err == nil && !existing {
+		// The code may have been cached as missing.
+		c.invalidate(code)
+	}
+
+	return code, existing, err
+}
+
+func (c *CachingURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := c.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+// Resolve serves cached links and otherwise makes a single call to the
+// store behind, caching what it returns. Limited links are never cached, so
+// each of their visits reaches the store and consumes a click.
+func (c *CachingURLStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	if item, ok := c.get(code); ok {
+		c.hits.Add(1)
+		if item.missing {
+			return URLEntry{}, ErrCodeNotFound
+		}
+		if item.entry.Expired(c.now()) {
+			return URLEntry{}, ErrCodeExpired
+		}
+		return item.entry, nil
+	}
+	c.misses.Add(1)
+
+	generation := c.currentGeneration()
+	entry, err := c.URLStore.Resolve(ctx, code)
+	c.store(generation, code, entry, err)
+
+	return entry, err
+}
+
+func (c *CachingURLStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	if item, ok := c.get(code); ok {
+		c.hits.Add(1)
+		if item.missing {
+			return URLEntry{}, ErrCodeNotFound
+		}
+		return item.entry, nil
+	}
+	c.misses.Add(1)
+
+	generation := c.currentGeneration()
+	entry, err := c.URLStore.Lookup(ctx, code)
+	c.store(generation, code, entry, err)
+
+	return entry, err
+}
+
+// store caches the result of loading code from the store behind: a
+// missing code or an unlimited link.
+func (c *CachingURLStore) store(generation uint64, code string, entry URLEntry, err error) {
+	switch {
+	case err == ErrCodeNotFound:
+		if c.negativeTTL > 0 {
+			c.put(generation, &cacheItem{code: code, missing: true, expires: c.now().Add(c.negativeTTL)})
+		}
+	case err == nil && entry.ClicksRemaining == nil:
+		c.put(generation, &cacheItem{code: code, entry: entry, expires: c.now().Add(c.ttl)})
+	}
+}
+
+func (c *CachingURLStore) Update(ctx context.Context, code, url, userID string) error {
+	defer c.invalidate(code)
+
+	return c.URLStore.Update(ctx, code, url, userID)
+}
+
+func (c *CachingURLStore) SetMetadata(ctx context.Context, code, url string, meta LinkMetadata) error {
+	defer c.invalidate(code)
+
+	return c.URLStore.SetMetadata(ctx, code, url, meta)
+}
+
+func (c *CachingURLStore) Delete(ctx context.Context, code, userID string) error {
+	defer c.invalidate(code)
+
+	return c.URLStore.Delete(ctx, code, userID)
+}
+
+func (c *CachingURLStore) PurgeExpired(ctx context.Context) (int, error) {
+	removed, err := c.URLStore.PurgeExpired(ctx)
+	if removed > 0 {
+		// Purged links would otherwise keep answering "expired" rather than
+		// "not found" until their cache TTL ran out.
+		c.mutex.Lock()
+		now := c.now()
+		for e := c.order.Front(); e != nil; {
+			next := e.Next()
+			if item := e.Value.(*cacheItem); !item.missing && item.entry.Expired(now) {
+				c.remove(e)
+			}
+			e = next
+		}
+		c.generation++
+		c.mutex.Unlock()
+	}
+
+	return removed, err
+}
+
+func (c *CachingURLStore) get(code string) (*cacheItem, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.items[code]
+	if !ok {
+		return nil, false
+	}
+
+	item := e.Value.(*cacheItem)
+	if !c.now().Before(item.expires) {
+		c.remove(e)
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+
+	return item, true
+}
+
+func (c *CachingURLStore) put(generation uint64, item *cacheItem) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if e, ok := c.items[item.code]; ok {
+		e.Value = item
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[item.code] = c.order.PushFront(item)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops e from the cache. The caller must hold c.mutex.
+func (c *CachingURLStore) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.items, e.Value.(*cacheItem).code)
+}
+
+func (c *CachingURLStore) invalidate(code string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if e, ok := c.items[code]; ok {
+		c.remove(e)
+	}
+	c.generation++
+}
+
+func (c *CachingURLStore) currentGeneration() uint64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.generation
+}
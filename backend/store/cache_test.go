@@ -0,0 +1,173 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// countingStore counts the lookups that reach the wrapped store.
+type countingStore struct {
+	URLStore
+	lookups int
+}
+
+func (s *countingStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	s.lookups++
+	return s.URLStore.Lookup(ctx, code)
+}
+
+func (s *countingStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	s.lookups++
+	return s.URLStore.Resolve(ctx, code)
+}
+
+func newTestCache(size int) (*CachingURLStore, *countingStore, *time.Time) {
+	backend := &countingStore{URLStore: NewInMemoryURLStore()}
+	cache := NewCachingURLStore(backend, size, time.Minute, 10*time.Second)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	return cache, backend, &now
+}
+
+func TestCachingURLStore_HitsAndTTL(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, now := newTestCache(10)
+
+	code, err := cache.Set(ctx, "https://example.com")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if url, err := cache.Get(ctx, code); err != nil || url != "https://example.com" {
+			t.Fatalf("Expected https://example.com, got %q (%v)", url, err)
+		}
+	}
+	if backend.lookups != 1 {
+		t.Errorf("Expected 1 backend lookup, got %d", backend.lookups)
+	}
+	if hits, misses := cache.CacheStats(); hits != 2 || misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %d and %d", hits, misses)
+	}
+
+	// Entries are reloaded once their TTL has passed
+	*now = now.Add(2 * time.Minute)
+	if _, err := cache.Get(ctx, code); err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+	if backend.lookups != 2 {
+		t.Errorf("Expected a reload after the TTL, got %d lookups", backend.lookups)
+	}
+}
+
+func TestCachingURLStore_NegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, now := newTestCache(10)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(ctx, "mylink"); err != ErrCodeNotFound {
+			t.Fatalf("Expected ErrCodeNotFound, got %v", err)
+		}
+	}
+	if backend.lookups != 1 {
+		t.Errorf("Expected 1 backend lookup for a missing code, got %d", backend.lookups)
+	}
+
+	// Creating the code replaces the cached miss
+	if _, _, err := cache.SetWithOptions(ctx, "https://example.com", SetOptions{Alias: "mylink"}); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if url, err := cache.Get(ctx, "mylink"); err != nil || url != "https://example.com" {
+		t.Errorf("Expected the new alias to resolve, got %q (%v)", url, err)
+	}
+
+	// Misses expire sooner than hits
+	if _, err := cache.Get(ctx, "other"); err != ErrCodeNotFound {
+		t.Fatalf("Expected ErrCodeNotFound, got %v", err)
+	}
+	lookups := backend.lookups
+	*now = now.Add(11 * time.Second)
+	cache.Get(ctx, "other")
+	if backend.lookups != lookups+1 {
+		t.Errorf("Expected the miss to be reloaded after its TTL")
+	}
+}
+
+func TestCachingURLStore_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestCache(10)
+
+	code, _, err := cache.SetWithOptions(ctx, "https://example.com", SetOptions{UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	cache.Get(ctx, code)
+
+	if err := cache.Update(ctx, code, "https://example.org", "owner"); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if url, _ := cache.Get(ctx, code); url != "https://example.org" {
+		t.Errorf("Expected updated URL, got %s", url)
+	}
+
+	if err := cache.Delete(ctx, code, "owner"); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if _, err := cache.Get(ctx, code); err != ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound after delete, got %v", err)
+	}
+}
+
+func TestCachingURLStore_Eviction(t *testing.T) {
+	ctx := context.Background()
+	cache, backend, _ := newTestCache(2)
+
+	var codes []string
+	for i := 0; i < 3; i++ {
+		code, err := cache.Set(ctx, "https://example.com")
+		if err != nil {
+			t.Fatalf("Failed to set URL: %v", err)
+		}
+		codes = append(codes, code)
+	}
+
+	cache.Get(ctx, codes[0])
+	cache.Get(ctx, codes[1])
+	cache.Get(ctx, codes[0]) // codes[1] is now least recently used
+	cache.Get(ctx, codes[2])
+
+	if n := cache.Len(); n != 2 {
+		t.Errorf("Expected 2 cached links, got %d", n)
+	}
+
+	lookups := backend.lookups
+	cache.Get(ctx, codes[0])
+	if backend.lookups != lookups {
+		t.Errorf("Expected %s to stay cached", codes[0])
+	}
+	cache.Get(ctx, codes[1])
+	if backend.lookups != lookups+1 {
+		t.Errorf("Expected %s to have been evicted", codes[1])
+	}
+}
+
+func TestCachingURLStore_ClickLimitedBypass(t *testing.T) {
+	ctx := context.Background()
+	cache, _, _ := newTestCache(10)
+
+	code, _, err := cache.SetWithOptions(ctx, "https://example.com", SetOptions{MaxClicks: 1})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	if _, err := cache.Get(ctx, code); err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+	if _, err := cache.Get(ctx, code); err != ErrClicksExhausted {
+		t.Errorf("Expected ErrClicksExhausted, got %v", err)
+	}
+	if n := cache.Len(); n != 0 {
+		t.Errorf("Expected click-limited links not to be cached, got %d entries", n)
+	}
+}
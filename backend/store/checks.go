@@ -0,0 +1,110 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxCheckHistory is how many checks a CheckStore keeps per link; older
+// ones are dropped as new ones are recorded.
+const MaxCheckHistory = 100
+
+// LinkCheck is one check of a link's destination, kept as its health
+// history. URL is the destination checked, which may since have been
+// changed, and Health is the link's health after the check.
+type LinkCheck struct {
+	Code       string    `json:"-"`
+	URL        string    `json:"url"`
+	CheckedAt  time.Time `json:"checked_at"`
+	Status     string    `json:"status"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Health     string    `json:"health"`
+}
+
+type CheckStore interface {
+	RecordCheck(check LinkCheck) error
+	// CheckHistory returns up to limit of the most recent checks of code,
+	// newest first.
+	CheckHistory(code string, limit int) ([]LinkCheck, error)
+	DeleteChecks(code string) error
+}
+
+type InMemoryCheckStore struct {
+	checks map[string][]LinkCheck
+	mutex  sync.RWMutex
+}
+
+func NewInMemoryCheckStore() *InMemoryCheckStore {
+	return &InMemoryCheckStore{
+		checks: make(map[string][]LinkCheck),
+	}
+}
+
+func (s *InMemoryCheckStore) RecordCheck(check LinkCheck) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	checks := append(s.checks[check.Code], check)
+	if len(checks) > MaxCheckHistory {
+		checks = append([]LinkCheck(nil), checks[len(checks)-MaxCheckHistory:]...)
+	}
+	s.checks[check.Code] = checks
+
+	return nil
+}
+
+func (s *InMemoryCheckStore) CheckHistory(code string, limit int) ([]LinkCheck, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	checks := s.checks[code]
+	history := make([]LinkCheck, 0, min(limit, len(checks)))
+	for i := len(checks) - 1; i >= 0 && len(history) < limit; i-- {
+		history = append(history, checks[i])
+	}
+
+	return history, nil
+}
+
+func (s *InMemoryCheckStore) DeleteChecks(code string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.checks, code)
+
+	return nil
+}
+
+// checkDue returns when the entry's destination is due for a check: its
+// NextCheckAt, or its creation if no check has scheduled another.
+func (e URLEntry) checkDue() time.Time {
+	if e.Metadata == nil || e.Metadata.NextCheckAt == nil {
+		return e.CreatedAt
+	}
+	return *e.Metadata.NextCheckAt
+}
+
+// dueEntries picks up to limit of entries that are live and due for a
+// check at now, most overdue first, for stores without an index to ask.
+func dueEntries(entries []URLEntry, now time.Time, limit int) []URLEntry {
+	due := []URLEntry{}
+	for _, entry := range entries {
+		if entry.Expired(now) || (entry.ClicksRemaining != nil && *entry.ClicksRemaining <= 0) {
+			continue
+		}
+		if !entry.checkDue().After(now) {
+			due = append(due, entry)
+		}
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].checkDue().Before(due[j].checkDue())
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	return due
+}
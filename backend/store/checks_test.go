@@ -0,0 +1,76 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func testCheckStore(t *testing.T, checks CheckStore) {
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < MaxCheckHistory+5; i++ {
+		check := LinkCheck{
+			Code:      "abc",
+			URL:       "https://example.com",
+			CheckedAt: start.Add(time.Duration(i) * time.Second),
+			Status:    CheckOK,
+			Health:    LinkHealthy,
+		}
+		if err := checks.RecordCheck(check); err != nil {
+			t.Fatalf("Failed to record check: %v", err)
+		}
+	}
+	broken := LinkCheck{Code: "abc", CheckedAt: time.Now(), Status: CheckFailed, Error: "connection refused", Health: LinkBroken}
+	if err := checks.RecordCheck(broken); err != nil {
+		t.Fatalf("Failed to record check: %v", err)
+	}
+	if err := checks.RecordCheck(LinkCheck{Code: "other", CheckedAt: time.Now(), Status: CheckOK, Health: LinkHealthy}); err != nil {
+		t.Fatalf("Failed to record check: %v", err)
+	}
+
+	history, err := checks.CheckHistory("abc", 3)
+	if err != nil {
+		t.Fatalf("Failed to get check history: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("Expected 3 checks, got %d", len(history))
+	}
+	if history[1].URL != "https://example.com" {
+		t.Errorf("Expected the checked URL to be kept, got %q", history[1].URL)
+	}
+	if history[0].Health != LinkBroken || history[0].Error != broken.Error {
+		t.Errorf("Expected the newest check first, got %+v", history[0])
+	}
+	if !history[1].CheckedAt.After(history[2].CheckedAt) {
+		t.Errorf("Expected checks newest first, got %v then %v", history[1].CheckedAt, history[2].CheckedAt)
+	}
+
+	// Only the most recent checks are kept
+	history, err = checks.CheckHistory("abc", MaxCheckHistory*2)
+	if err != nil {
+		t.Fatalf("Failed to get check history: %v", err)
+	}
+	if len(history) != MaxCheckHistory {
+		t.Errorf("Expected %d checks to be kept, got %d", MaxCheckHistory, len(history))
+	}
+	if oldest := history[len(history)-1]; !oldest.CheckedAt.Equal(start.Add(6 * time.Second)) {
+		t.Errorf("Expected the oldest checks to be dropped, oldest kept is from %v", oldest.CheckedAt)
+	}
+
+	if err := checks.DeleteChecks("abc"); err != nil {
+		t.Fatalf("Failed to delete checks: %v", err)
+	}
+	if history, _ := checks.CheckHistory("abc", 10); len(history) != 0 {
+		t.Errorf("Expected no checks after delete, got %d", len(history))
+	}
+	if history, _ := checks.CheckHistory("other", 10); len(history) != 1 {
+		t.Errorf("Expected other links' checks to be kept, got %d", len(history))
+	}
+}
+
+func TestInMemoryCheckStore(t *testing.T) {
+	testCheckStore(t, NewInMemoryCheckStore())
+}
+
+func TestBoltCheckStore(t *testing.T) {
+	testCheckStore(t, newTestBoltStore(t, t.TempDir()).CheckStore())
+}
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const clickDateLayout = "2006-01-02"
+
+// Click is a single recorded visit to a short link. IPHash holds a keyed
+// hash of the client address so visitors can be counted without storing IPs.
+type Click struct {
+	Code      string    `json:"code"`
+	Timestamp time.Time `json:"timestamp"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IPHash    string    `json:"ip_hash,omitempty"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int64  `json:"clicks"`
+}
+
+type ReferrerClicks struct {
+	Referrer string `json:"referrer"`
+	Clicks   int64  `json:"clicks"`
+}
+
+type ClickStats struct {
+	Code           string           `json:"code"`
+	TotalClicks    int64            `json:"total_clicks"`
+	UniqueVisitors int64            `json:"unique_visitors"`
+	Daily          []DailyClicks    `json:"daily"`
+	TopReferrers   []ReferrerClicks `json:"top_referrers"`
+}
+
+type ClickStore interface {
+	RecordClicks(clicks []Click) error
+	// ClickStats aggregates the clicks for code. Totals cover the whole
+	// history of the link while the daily series and referrers only cover
+	// clicks at or after since.
+	ClickStats(code string, since time.Time, topReferrers int) (ClickStats, error)
+	DeleteClicks(code string) error
+}
+
+type InMemoryClickStore struct {
+	clicks map[string][]Click
+	mutex  sync.RWMutex
+}
+
+func NewInMemoryClickStore() *InMemoryClickStore {
+	return &InMemoryClickStore{
+		clicks: make(map[string][]Click),
+	}
+}
+
+func (s *InMemoryClickStore) RecordClicks(clicks []Click) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, click := range clicks {
+		s.clicks[click.Code] = append(s.clicks[click.Code], click)
+	}
+
+	return nil
+}
+
+func (s *InMemoryClickStore) DeleteClicks(code string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.clicks, code)
+
+	return nil
+}
+
+func (s *InMemoryClickStore) ClickStats(code string, since time.Time, topReferrers int) (ClickStats, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return aggregateClicks(code, s.clicks[code], since, topReferrers), nil
+}
+
+// aggregateClicks computes ClickStats from the full click history of code.
+func aggregateClicks(code string, clicks []Click, since time.Time, topReferrers int) ClickStats {
+	visitors := make(map[string]bool)
+	daily := make(map[string]int64)
+	referrers := make(map[string]int64)
+
+	for _, click := range clicks {
+		if click.IPHash != "" {
+			visitors[click.IPHash] = true
+		}
+		if click.Timestamp.Before(since) {
+			continue
+		}
+		daily[click.Timestamp.UTC().Format(clickDateLayout)]++
+		if click.Referrer != "" {
+			referrers[click.Referrer]++
+		}
+	}
+
+	top := make([]ReferrerClicks, 0, len(referrers))
+	for referrer, count := range referrers {
+		top = append(top, ReferrerClicks{Referrer: referrer, Clicks: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Clicks != top[j].Clicks {
+			return top[i].Clicks > top[j].Clicks
+		}
+		return top[i].Referrer < top[j].Referrer
+	})
+	if len(top) > topReferrers {
+		top = top[:topReferrers]
+	}
+
+	return ClickStats{
+		Code:           code,
+		TotalClicks:    int64(len(clicks)),
+		UniqueVisitors: int64(len(visitors)),
+		Daily:          dailySeries(daily, since, time.Now()),
+		TopReferrers:   top,
+	}
+}
+
+// dailySeries turns per-day counts keyed by date into a contiguous series
+// from since to now, filling days without clicks with zero.
+func dailySeries(counts map[string]int64, since, now time.Time) []DailyClicks {
+	day := since.UTC().Truncate(24 * time.Hour)
+	end := now.UTC().Truncate(24 * time.Hour)
+
+	series := []DailyClicks{}
+	for !day.After(end) {
+		date := day.Format(clickDateLayout)
+		series = append(series, DailyClicks{Date: date, Clicks: counts[date]})
+		day = day.Add(24 * time.Hour)
+	}
+
+	return series
+}
@@ -0,0 +1,47 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInMemoryClickStore_ClickStats(t *testing.T) {
+	store := NewInMemoryClickStore()
+
+	now := time.Now()
+	clicks := []Click{
+		{Code: "abc", Timestamp: now, Referrer: "https://a.example", IPHash: "ip1"},
+		{Code: "abc", Timestamp: now, Referrer: "https://a.example", IPHash: "ip2"},
+		{Code: "abc", Timestamp: now, Referrer: "https://b.example", IPHash: "ip1"},
+		{Code: "abc", Timestamp: now.AddDate(0, 0, -10), Referrer: "https://c.example", IPHash: "ip3"},
+		{Code: "other", Timestamp: now, IPHash: "ip1"},
+	}
+	if err := store.RecordClicks(clicks); err != nil {
+		t.Fatalf("Failed to record clicks: %v", err)
+	}
+
+	since := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -6)
+	stats, err := store.ClickStats("abc", since, 1)
+	if err != nil {
+		t.Fatalf("Failed to get click stats: %v", err)
+	}
+
+	if stats.TotalClicks != 4 {
+		t.Errorf("Expected 4 total clicks, got %d", stats.TotalClicks)
+	}
+	if stats.UniqueVisitors != 3 {
+		t.Errorf("Expected 3 unique visitors, got %d", stats.UniqueVisitors)
+	}
+
+	// The series covers every day in the window, ending today
+	if len(stats.Daily) != 7 {
+		t.Fatalf("Expected 7 days in series, got %d", len(stats.Daily))
+	}
+	if today := stats.Daily[6]; today.Clicks != 3 {
+		t.Errorf("Expected 3 clicks today, got %d", today.Clicks)
+	}
+
+	if len(stats.TopReferrers) != 1 || stats.TopReferrers[0].Referrer != "https://a.example" {
+		t.Errorf("Expected https://a.example as top referrer, got %v", stats.TopReferrers)
+	}
+}
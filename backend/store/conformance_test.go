@@ -0,0 +1,71 @@
+package store_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+	"github.com/priyankeshh/url-shortener/backend/store/storetest"
+)
+
+func TestInMemoryURLStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		return store.NewInMemoryURLStore()
+	})
+}
+
+func TestBoltURLStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		s, err := store.NewBoltURLStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to open file store: %v", err)
+		}
+		t.Cleanup(func() {
+			s.Close()
+		})
+		return s
+	})
+}
+
+func TestPostgresURLStore_Conformance(t *testing.T) {
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	s, err := store.NewPostgresURLStore(connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	defer s.Close()
+
+	// Subtests share one connection pool; the suite keeps their data apart.
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		return s
+	})
+}
+
+func TestValidatingURLStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		return store.NewValidatingURLStore(store.NewInMemoryURLStore(), store.DefaultAliasPolicy)
+	})
+}
+
+func TestCachingURLStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		return store.NewCachingURLStore(store.NewInMemoryURLStore(), 100, time.Minute, time.Minute)
+	})
+}
+
+func TestBloomURLStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.URLStore {
+		memory := store.NewInMemoryURLStore()
+		bloom := store.NewBloomURLStore(memory, memory, 0.01)
+		if err := bloom.Rebuild(context.Background()); err != nil {
+			t.Fatalf("Failed to build filter: %v", err)
+		}
+		return bloom
+	})
+}
@@ -0,0 +1,57 @@
+package store
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultPorts are dropped from hosts when comparing destinations.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// URLKey normalizes rawURL for duplicate detection: the scheme and host are
+// lowercased, a default port and the fragment are dropped and an empty path
+// becomes "/". URLs that do not parse are compared verbatim.
+func URLKey(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && port != defaultPorts[u.Scheme] {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+
+	return u.String()
+}
+
+// dedupeKey returns the key under which a link created with opts is
+// registered for deduplication, or "" if it is not eligible. Only plain
+// links take part: an alias, expiry or click limit asks for a link of its
+// own.
+func (opts SetOptions) dedupeKey(url string) string {
+	if !opts.Dedupe || opts.Alias != "" || !opts.ExpiresAt.IsZero() || opts.MaxClicks > 0 {
+		return ""
+	}
+	return URLKey(url)
+}
+
+// userDedupeKey joins a user and a URL key for the secondary indexes of the
+// memory and file stores.
+func userDedupeKey(userID, urlKey string) string {
+	return userID + "\x00" + urlKey
+}
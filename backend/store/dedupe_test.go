@@ -0,0 +1,26 @@
+package store
+
+import "testing"
+
+func TestURLKey(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"HTTPS://Example.COM/Path", "https://example.com/Path"},
+		{"https://example.com:443/a", "https://example.com/a"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"http://example.com:8080/a", "http://example.com:8080/a"},
+		{"https://example.com/a?b=1#frag", "https://example.com/a?b=1"},
+		{"https://[::1]:443/a", "https://[::1]/a"},
+		{"https://[::1]:8443/a", "https://[::1]:8443/a"},
+		{"not a url", "not a url"},
+	}
+
+	for _, tt := range tests {
+		if got := URLKey(tt.url); got != tt.want {
+			t.Errorf("URLKey(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
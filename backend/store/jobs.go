@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrLeaseLost is returned when a job is settled by a worker whose lease on
+// it has expired, so another worker may have leased it since.
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job is a queued check of URL, the destination of Code.
+//
+// A leased job carries the worker that leased it and AvailableAt is when
+// the lease expires and the job becomes visible to other workers again.
+// Attempts counts leases, less those released without being worked on, so
+// a job whose worker died still runs out of attempts eventually.
+type Job struct {
+	ID          int64     `json:"id"`
+	Code        string    `json:"code"`
+	URL         string    `json:"url"`
+	Attempts    int       `json:"attempts"`
+	LeasedBy    string    `json:"leased_by,omitempty"`
+	AvailableAt time.Time `json:"available_at"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// DeadJob is a job that was given up on, kept for inspection.
+type DeadJob struct {
+	Job
+	FailedAt time.Time `json:"failed_at"`
+}
+
+type JobQueueStats struct {
+	// Queued counts jobs waiting for a worker, including retries that are
+	// not due yet and jobs whose lease has expired.
+	Queued int
+	Leased int
+	Dead   int
+}
+
+// JobQueue is a durable queue of URL checks shared by every worker, in this
+// process or another. Workers lease jobs for a visibility timeout and then
+// settle each one with Complete, Retry or DeadLetter; a job that is not
+// settled in time is leased again. Settling fails with ErrLeaseLost when
+// the lease has expired. Like URLStore, every method takes the caller's
+// context and implementations that do I/O stop once it is done.
+type JobQueue interface {
+	// Enqueue queues a check of url unless one for the same code and url
+	// is already queued, and reports whether it queued one.
+	Enqueue(ctx context.Context, code, url string) (bool, error)
+	// Lease hands worker up to limit jobs that are available at now,
+	// oldest first, hiding them from other workers until now+visibility.
+	Lease(ctx context.Context, worker string, now time.Time, visibility time.Duration, limit int) ([]Job, error)
+	Complete(ctx context.Context, job Job) error
+	// Retry returns a leased job to the queue to be leased again at
+	// availableAt, recording reason as its last error.
+	Retry(ctx context.Context, job Job, availableAt time.Time, reason string) error
+	// Release returns a leased job that was never worked on to the queue,
+	// to be leased again at once, without counting the lease as an attempt.
+	Release(ctx context.Context, job Job) error
+	// DeadLetter moves a leased job to the dead letters.
+	DeadLetter(ctx context.Context, job Job, now time.Time, reason string) error
+	// DeadLetters returns up to limit of the most recent dead letters,
+	// newest first.
+	DeadLetters(ctx context.Context, limit int) ([]DeadJob, error)
+	JobStats(ctx context.Context, now time.Time) (JobQueueStats, error)
+}
+
+// leasedBy reports whether stored, the queue's copy of a job, is still
+// leased as job says it is.
+func leasedBy(stored, job Job) bool {
+	return stored.LeasedBy != "" && stored.LeasedBy == job.LeasedBy && stored.Attempts == job.Attempts
+}
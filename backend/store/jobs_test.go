@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testJobQueue(t *testing.T, queue JobQueue) {
+	ctx := context.Background()
+
+	for _, code := range []string{"a", "b", "c"} {
+		if queued, err := queue.Enqueue(ctx, code, "https://example.com/"+code); err != nil || !queued {
+			t.Fatalf("Failed to enqueue job %s: %v", code, err)
+		}
+	}
+	if queued, err := queue.Enqueue(ctx, "a", "https://example.com/a"); err != nil || queued {
+		t.Errorf("Expected a duplicate job not to be queued, got %v (%v)", queued, err)
+	}
+
+	now := time.Now().Add(time.Second)
+	leased, err := queue.Lease(ctx, "worker-1", now, time.Minute, 2)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(leased) != 2 || leased[0].Code != "a" || leased[1].Code != "b" {
+		t.Fatalf("Expected jobs a and b, got %+v", leased)
+	}
+	if leased[0].Attempts != 1 || leased[0].LeasedBy != "worker-1" {
+		t.Errorf("Expected a first attempt by worker-1, got %+v", leased[0])
+	}
+
+	// Leased jobs are hidden from other workers
+	other, err := queue.Lease(ctx, "worker-2", now, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(other) != 1 || other[0].Code != "c" {
+		t.Fatalf("Expected only job c, got %+v", other)
+	}
+	if stats, err := queue.JobStats(ctx, now); err != nil || stats != (JobQueueStats{Leased: 3}) {
+		t.Errorf("Expected 3 leased jobs, got %+v (%v)", stats, err)
+	}
+
+	if err := queue.Complete(ctx, leased[0]); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+	if err := queue.Retry(ctx, leased[1], now.Add(time.Hour), "connection refused"); err != nil {
+		t.Fatalf("Failed to retry job: %v", err)
+	}
+	if stats, _ := queue.JobStats(ctx, now); stats != (JobQueueStats{Queued: 1, Leased: 1}) {
+		t.Errorf("Expected 1 queued and 1 leased job, got %+v", stats)
+	}
+
+	// An expired lease is taken over, and the first worker can no longer
+	// settle the job
+	later := now.Add(2 * time.Minute)
+	retaken, err := queue.Lease(ctx, "worker-1", later, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(retaken) != 1 || retaken[0].Code != "c" || retaken[0].Attempts != 2 {
+		t.Fatalf("Expected job c on its second attempt, got %+v", retaken)
+	}
+	if err := queue.Complete(ctx, other[0]); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost, got %v", err)
+	}
+
+	if err := queue.DeadLetter(ctx, retaken[0], later, "timed out"); err != nil {
+		t.Fatalf("Failed to dead-letter job: %v", err)
+	}
+	dead, err := queue.DeadLetters(ctx, 10)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters: %v", err)
+	}
+	if len(dead) != 1 || dead[0].Code != "c" || dead[0].LastError != "timed out" || dead[0].Attempts != 2 {
+		t.Errorf("Expected job c to be dead-lettered, got %+v", dead)
+	}
+
+	// The retried job comes back once its backoff has passed
+	retried, err := queue.Lease(ctx, "worker-2", now.Add(2*time.Hour), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(retried) != 1 || retried[0].Code != "b" || retried[0].LastError != "connection refused" {
+		t.Fatalf("Expected job b with its last error, got %+v", retried)
+	}
+	// A released lease is not counted as an attempt
+	if err := queue.Release(ctx, retried[0]); err != nil {
+		t.Fatalf("Failed to release job: %v", err)
+	}
+	released, err := queue.Lease(ctx, "worker-1", now.Add(2*time.Hour), time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Failed to lease jobs: %v", err)
+	}
+	if len(released) != 1 || released[0].Code != "b" || released[0].Attempts != retried[0].Attempts {
+		t.Fatalf("Expected job b still on attempt %d, got %+v", retried[0].Attempts, released)
+	}
+	if err := queue.Release(ctx, retried[0]); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost releasing a lease taken over, got %v", err)
+	}
+	if stats, _ := queue.JobStats(ctx, now.Add(2*time.Hour)); stats != (JobQueueStats{Leased: 1, Dead: 1}) {
+		t.Errorf("Expected 1 leased and 1 dead job, got %+v", stats)
+	}
+}
+
+func TestBoltJobQueue(t *testing.T) {
+	testJobQueue(t, newTestBoltStore(t, t.TempDir()).JobQueue())
+}
+
+func TestBoltJobQueue_OwnFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	queue, err := OpenBoltJobQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to open job queue: %v", err)
+	}
+	if _, err := queue.Enqueue(ctx, "a", "https://example.com/a"); err != nil {
+		t.Fatalf("Failed to enqueue job: %v", err)
+	}
+	queue.Close()
+
+	// Jobs survive reopening the file
+	queue, err = OpenBoltJobQueue(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen job queue: %v", err)
+	}
+	defer queue.Close()
+
+	leased, err := queue.Lease(ctx, "worker", time.Now().Add(time.Second), time.Minute, 10)
+	if err != nil || len(leased) != 1 || leased[0].Code != "a" {
+		t.Errorf("Expected job a after reopening, got %+v (%v)", leased, err)
+	}
+}
+
+func TestBoltJobQueue_CancelledContext(t *testing.T) {
+	queue := newTestBoltStore(t, t.TempDir()).JobQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := queue.Enqueue(ctx, "a", "https://example.com/a"); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from Enqueue, got %v", err)
+	}
+	if _, err := queue.Lease(ctx, "worker", time.Now(), time.Minute, 10); err != context.Canceled {
+		t.Errorf("Expected context.Canceled from Lease, got %v", err)
+	}
+}
+
+func TestPostgresJobQueue(t *testing.T) {
+	store := newTestPostgresStore(t)
+	if _, err := store.db.Exec("DELETE FROM url_jobs; DELETE FROM url_jobs_dead"); err != nil {
+		t.Fatalf("Failed to clear job queue: %v", err)
+	}
+
+	testJobQueue(t, store.JobQueue())
+}
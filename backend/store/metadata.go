@@ -0,0 +1,44 @@
+package store
+
+import "time"
+
+// Link check statuses recorded in LinkMetadata.Status.
+const (
+	// CheckOK means the destination answered, whatever its status code.
+	CheckOK = "ok"
+	// CheckFailed means the destination could not be reached.
+	CheckFailed = "failed"
+	// CheckBlocked means the destination resolves to an internal address
+	// and was not contacted.
+	CheckBlocked = "blocked"
+)
+
+// Link health states recorded in LinkMetadata.Health.
+const (
+	LinkHealthy = "healthy"
+	LinkBroken  = "broken"
+)
+
+// LinkMetadata is what the URL processor last learned about a link's
+// destination.
+type LinkMetadata struct {
+	CheckedAt   time.Time `json:"checked_at"`
+	Status      string    `json:"status"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	ContentType string    `json:"content_type,omitempty"`
+	Title       string    `json:"title,omitempty"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	FaviconURL  string    `json:"favicon_url,omitempty"`
+	// Error describes why the check failed or was blocked.
+	Error string `json:"error,omitempty"`
+
+	// Health is LinkHealthy or LinkBroken, judged over consecutive checks
+	// rather than the last one alone, and HealthSince is when it last
+	// changed. Failures counts the consecutive failed checks.
+	Health      string     `json:"health,omitempty"`
+	HealthSince *time.Time `json:"health_since,omitempty"`
+	Failures    int        `json:"failures,omitempty"`
+	// NextCheckAt is when the destination is due to be checked again.
+	NextCheckAt *time.Time `json:"next_check_at,omitempty"`
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	migrations, err := loadMigrations(migrationsFS, "migrations")
+	if err != nil {
+		t.Fatalf("Failed to load embedded migrations: %v", err)
+	}
+
+	// Versions must be contiguous starting at 1
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Expected migration version %d, got %d", i+1, migration.Version)
+		}
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"m/0001_init.up.sql": {Data: []byte("SELECT 1")},
+		},
+		"bad name": {
+			"m/init.up.sql":   {Data: []byte("SELECT 1")},
+			"m/init.down.sql": {Data: []byte("SELECT 1")},
+		},
+		"conflicting names": {
+			"m/0001_init.up.sql":    {Data: []byte("SELECT 1")},
+			"m/0001_other.down.sql": {Data: []byte("SELECT 1")},
+		},
+	}
+
+	for name, fsys := range tests {
+		if _, err := loadMigrations(fsys, "m"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestPostgresMigrator_UpDown(t *testing.T) {
+	store := newTestPostgresStore(t)
+
+	migrator, err := NewMigrator(store.db)
+	if err != nil {
+		t.Fatalf("Failed to create migrator: %v", err)
+	}
+
+	// The store applied everything on startup
+	if applied, err := migrator.Up(); err != nil || applied != 0 {
+		t.Fatalf("Expected no pending migrations, got %d (%v)", applied, err)
+	}
+
+	if reverted, err := migrator.Down(1); err != nil || reverted != 1 {
+		t.Fatalf("Expected 1 reverted migration, got %d (%v)", reverted, err)
+	}
+	if applied, err := migrator.Up(); err != nil || applied != 1 {
+		t.Fatalf("Expected 1 re-applied migration, got %d (%v)", applied, err)
+	}
+}
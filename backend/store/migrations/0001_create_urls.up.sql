@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS urls (
+	code TEXT PRIMARY KEY,
+	url TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls(user_id);
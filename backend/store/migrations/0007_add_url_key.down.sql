@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_urls_user_url_key;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS url_key;
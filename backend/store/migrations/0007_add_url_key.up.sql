@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS url_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_user_url_key ON urls(user_id, url_key) WHERE url_key IS NOT NULL;
@@ -0,0 +1,6 @@
+ALTER TABLE urls DROP COLUMN IF EXISTS check_error;
+ALTER TABLE urls DROP COLUMN IF EXISTS title;
+ALTER TABLE urls DROP COLUMN IF EXISTS content_type;
+ALTER TABLE urls DROP COLUMN IF EXISTS check_status_code;
+ALTER TABLE urls DROP COLUMN IF EXISTS check_status;
+ALTER TABLE urls DROP COLUMN IF EXISTS checked_at;
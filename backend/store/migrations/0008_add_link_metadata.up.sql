@@ -0,0 +1,6 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS checked_at TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_status TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_status_code INTEGER;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS content_type TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_error TEXT;
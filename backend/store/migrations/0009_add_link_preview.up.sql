@@ -0,0 +1,3 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS description TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS image_url TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS favicon_url TEXT;
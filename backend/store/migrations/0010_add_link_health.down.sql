@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS link_checks;
+
+DROP INDEX IF EXISTS idx_urls_check_due;
+
+ALTER TABLE urls DROP COLUMN IF EXISTS next_check_at;
+ALTER TABLE urls DROP COLUMN IF EXISTS check_failures;
+ALTER TABLE urls DROP COLUMN IF EXISTS health_since;
+ALTER TABLE urls DROP COLUMN IF EXISTS health;
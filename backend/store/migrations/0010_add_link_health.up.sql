@@ -0,0 +1,19 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health TEXT;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health_since TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS check_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS next_check_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_urls_check_due ON urls ((COALESCE(next_check_at, created_at)));
+
+CREATE TABLE IF NOT EXISTS link_checks (
+	id BIGSERIAL PRIMARY KEY,
+	code TEXT NOT NULL,
+	url TEXT NOT NULL,
+	checked_at TIMESTAMPTZ NOT NULL,
+	status TEXT NOT NULL,
+	status_code INTEGER,
+	error TEXT NOT NULL DEFAULT '',
+	health TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_checks_code_checked_at ON link_checks(code, checked_at);
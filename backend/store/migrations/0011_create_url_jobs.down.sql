@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS url_jobs_dead;
+DROP TABLE IF EXISTS url_jobs;
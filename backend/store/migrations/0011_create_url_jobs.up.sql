@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS url_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	code TEXT NOT NULL,
+	url TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	leased_by TEXT NOT NULL DEFAULT '',
+	available_at TIMESTAMPTZ NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	UNIQUE (code, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_jobs_available_at ON url_jobs(available_at);
+
+CREATE TABLE IF NOT EXISTS url_jobs_dead (
+	id BIGINT PRIMARY KEY,
+	code TEXT NOT NULL,
+	url TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_jobs_dead_failed_at ON url_jobs_dead(failed_at);
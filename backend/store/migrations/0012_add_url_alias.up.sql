@@ -0,0 +1 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS alias BOOLEAN NOT NULL DEFAULT false;
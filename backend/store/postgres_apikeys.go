@@ -0,0 +1,77 @@
+package store
+
+import (
+	"database/sql"
+)
+
+func (s *PostgresURLStore) CreateAPIKey(key APIKey) error {
+	_, err := s.db.Exec(
+		"INSERT INTO api_keys (id, key_hash, user_id, name, prefix, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+		key.ID, key.Hash, key.UserID, key.Name, key.Prefix, key.CreatedAt,
+	)
+	return err
+}
+
+func (s *PostgresURLStore) LookupAPIKey(hash string) (APIKey, error) {
+	var key APIKey
+	err := s.db.QueryRow(
+		"SELECT id, key_hash, user_id, name, prefix, created_at FROM api_keys WHERE key_hash = $1",
+		hash,
+	).Scan(&key.ID, &key.Hash, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return APIKey{}, ErrAPIKeyNotFound
+		}
+		return APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (s *PostgresURLStore) ListAPIKeys(userID string) ([]APIKey, error) {
+	rows, err := s.db.Query(
+		"SELECT id, key_hash, user_id, name, prefix, created_at FROM api_keys WHERE user_id = $1 ORDER BY created_at",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var key APIKey
+		if err := rows.Scan(&key.ID, &key.Hash, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *PostgresURLStore) RevokeAPIKey(id, userID string) error {
+	result, err := s.db.Exec("DELETE FROM api_keys WHERE id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	err = s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM api_keys WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrNotOwner
+	}
+
+	return ErrAPIKeyNotFound
+}
@@ -0,0 +1,74 @@
+package store
+
+import "database/sql"
+
+type PostgresCheckStore struct {
+	db *sql.DB
+}
+
+// CheckStore returns a CheckStore that shares the connection pool of the
+// URL store. The link_checks table is created by the migrations.
+func (s *PostgresURLStore) CheckStore() *PostgresCheckStore {
+	return &PostgresCheckStore{db: s.db}
+}
+
+func (s *PostgresCheckStore) RecordCheck(check LinkCheck) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"INSERT INTO link_checks (code, url, checked_at, status, status_code, error, health) VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		check.Code, check.URL, check.CheckedAt.UTC(), check.Status, nullInt(check.StatusCode), check.Error, check.Health,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Drop the oldest checks beyond the retained history.
+	_, err = tx.Exec(`
+		DELETE FROM link_checks
+		WHERE code = $1 AND id NOT IN (
+			SELECT id FROM link_checks WHERE code = $1 ORDER BY checked_at DESC, id DESC LIMIT $2
+		)
+	`, check.Code, MaxCheckHistory)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresCheckStore) CheckHistory(code string, limit int) ([]LinkCheck, error) {
+	rows, err := s.db.Query(`
+		SELECT url, checked_at, status, status_code, error, health
+		FROM link_checks
+		WHERE code = $1
+		ORDER BY checked_at DESC, id DESC
+		LIMIT $2
+	`, code, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []LinkCheck{}
+	for rows.Next() {
+		check := LinkCheck{Code: code}
+		var statusCode sql.NullInt64
+		if err := rows.Scan(&check.URL, &check.CheckedAt, &check.Status, &statusCode, &check.Error, &check.Health); err != nil {
+			return nil, err
+		}
+		check.StatusCode = int(statusCode.Int64)
+		history = append(history, check)
+	}
+
+	return history, rows.Err()
+}
+
+func (s *PostgresCheckStore) DeleteChecks(code string) error {
+	_, err := s.db.Exec("DELETE FROM link_checks WHERE code = $1", code)
+	return err
+}
@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PostgresClickStore struct {
+	db *sql.DB
+}
+
+// ClickStore returns a ClickStore that shares the connection pool of the
+// URL store. The clicks table is created alongside the urls table.
+func (s *PostgresURLStore) ClickStore() *PostgresClickStore {
+	return &PostgresClickStore{db: s.db}
+}
+
+func (s *PostgresClickStore) RecordClicks(clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(
+		"INSERT INTO clicks (code, clicked_at, referrer, user_agent, ip_hash) VALUES ($1, $2, $3, $4, $5)",
+	)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, click := range clicks {
+		if _, err := stmt.Exec(click.Code, click.Timestamp, click.Referrer, click.UserAgent, click.IPHash); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresClickStore) DeleteClicks(code string) error {
+	_, err := s.db.Exec("DELETE FROM clicks WHERE code = $1", code)
+	return err
+}
+
+func (s *PostgresClickStore) ClickStats(code string, since time.Time, topReferrers int) (ClickStats, error) {
+	stats := ClickStats{
+		Code:         code,
+		TopReferrers: []ReferrerClicks{},
+	}
+
+	err := s.db.QueryRow(
+		"SELECT COUNT(*), COUNT(DISTINCT NULLIF(ip_hash, '')) FROM clicks WHERE code = $1",
+		code,
+	).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		return ClickStats{}, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*)
+		FROM clicks
+		WHERE code = $1 AND clicked_at >= $2
+		GROUP BY day
+	`, code, since)
+	if err != nil {
+		return ClickStats{}, err
+	}
+	defer rows.Close()
+
+	daily := make(map[string]int64)
+	for rows.Next() {
+		var day string
+		var count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return ClickStats{}, err
+		}
+		daily[day] = count
+	}
+	if err := rows.Err(); err != nil {
+		return ClickStats{}, err
+	}
+	stats.Daily = dailySeries(daily, since, time.Now())
+
+	rows, err = s.db.Query(`
+		SELECT referrer, COUNT(*) AS clicks
+		FROM clicks
+		WHERE code = $1 AND clicked_at >= $2 AND referrer <> ''
+		GROUP BY referrer
+		ORDER BY clicks DESC, referrer
+		LIMIT $3
+	`, code, since, topReferrers)
+	if err != nil {
+		return ClickStats{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var referrer ReferrerClicks
+		if err := rows.Scan(&referrer.Referrer, &referrer.Clicks); err != nil {
+			return ClickStats{}, err
+		}
+		stats.TopReferrers = append(stats.TopReferrers, referrer)
+	}
+	if err := rows.Err(); err != nil {
+		return ClickStats{}, err
+	}
+
+	return stats, nil
+}
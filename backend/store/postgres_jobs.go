@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresJobQueue keeps jobs in the url_jobs table and dead letters in
+// url_jobs_dead. Leases are taken with FOR UPDATE SKIP LOCKED, so any
+// number of backend replicas can share the queue without waiting on each
+// other.
+type PostgresJobQueue struct {
+	db      *sql.DB
+	timeout time.Duration
+}
+
+// JobQueue returns a JobQueue that shares the connection pool of the URL
+// store and bounds each operation by the store's Jobs query timeout at the
+// time of the call. The tables are created by the migrations.
+func (s *PostgresURLStore) JobQueue() *PostgresJobQueue {
+	return &PostgresJobQueue{db: s.db, timeout: s.timeouts.Jobs}
+}
+
+func (q *PostgresJobQueue) Enqueue(ctx context.Context, code, url string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	now := time.Now().UTC()
+	result, err := q.db.ExecContext(ctx, `
+		INSERT INTO url_jobs (code, url, available_at, created_at)
+		VALUES ($1, $2, $3, $3)
+		ON CONFLICT (code, url) DO NOTHING
+	`, code, url, now)
+	if err != nil {
+		return false, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rows > 0, nil
+}
+
+func (q *PostgresJobQueue) Lease(ctx context.Context, worker string, now time.Time, visibility time.Duration, limit int) ([]Job, error) {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	rows, err := q.db.QueryContext(ctx, `
+		UPDATE url_jobs
+		SET attempts = attempts + 1, leased_by = $1, available_at = $2
+		WHERE id IN (
+			SELECT id FROM url_jobs
+			WHERE available_at <= $3
+			ORDER BY available_at, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, code, url, attempts, leased_by, available_at, last_error, created_at
+	`, worker, now.Add(visibility).UTC(), now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leased := []Job{}
+	for rows.Next() {
+		var job Job
+		if err := rows.Scan(&job.ID, &job.Code, &job.URL, &job.Attempts, &job.LeasedBy, &job.AvailableAt, &job.LastError, &job.CreatedAt); err != nil {
+			return nil, err
+		}
+		leased = append(leased, job)
+	}
+
+	return leased, rows.Err()
+}
+
+// leaseLost turns a settle statement that matched no row into ErrLeaseLost.
+func leaseLost(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrLeaseLost
+	}
+
+	return nil
+}
+
+func (q *PostgresJobQueue) Complete(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	return leaseLost(q.db.ExecContext(ctx,
+		"DELETE FROM url_jobs WHERE id = $1 AND leased_by = $2 AND attempts = $3",
+		job.ID, job.LeasedBy, job.Attempts,
+	))
+}
+
+func (q *PostgresJobQueue) Retry(ctx context.Context, job Job, availableAt time.Time, reason string) error {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	return leaseLost(q.db.ExecContext(ctx, `
+		UPDATE url_jobs
+		SET leased_by = '', available_at = $4, last_error = $5
+		WHERE id = $1 AND leased_by = $2 AND attempts = $3
+	`, job.ID, job.LeasedBy, job.Attempts, availableAt.UTC(), reason))
+}
+
+func (q *PostgresJobQueue) Release(ctx context.Context, job Job) error {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	return leaseLost(q.db.ExecContext(ctx, `
+		UPDATE url_jobs
+		SET attempts = attempts - 1, leased_by = '', available_at = $4
+		WHERE id = $1 AND leased_by = $2 AND attempts = $3
+	`, job.ID, job.LeasedBy, job.Attempts, time.Now().UTC()))
+}
+
+func (q *PostgresJobQueue) DeadLetter(ctx context.Context, job Job, now time.Time, reason string) error {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	return leaseLost(q.db.ExecContext(ctx, `
+		WITH dead AS (
+			DELETE FROM url_jobs
+			WHERE id = $1 AND leased_by = $2 AND attempts = $3
+			RETURNING id, code, url, attempts, created_at
+		)
+		INSERT INTO url_jobs_dead (id, code, url, attempts, last_error, created_at, failed_at)
+		SELECT id, code, url, attempts, $4, created_at, $5 FROM dead
+	`, job.ID, job.LeasedBy, job.Attempts, reason, now.UTC()))
+}
+
+func (q *PostgresJobQueue) DeadLetters(ctx context.Context, limit int) ([]DeadJob, error) {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	rows, err := q.db.QueryContext(ctx, `
+		SELECT id, code, url, attempts, last_error, created_at, failed_at
+		FROM url_jobs_dead
+		ORDER BY failed_at DESC, id DESC
+		LIMIT $1
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dead := []DeadJob{}
+	for rows.Next() {
+		var job DeadJob
+		if err := rows.Scan(&job.ID, &job.Code, &job.URL, &job.Attempts, &job.LastError, &job.CreatedAt, &job.FailedAt); err != nil {
+			return nil, err
+		}
+		job.AvailableAt = job.FailedAt
+		dead = append(dead, job)
+	}
+
+	return dead, rows.Err()
+}
+
+func (q *PostgresJobQueue) JobStats(ctx context.Context, now time.Time) (JobQueueStats, error) {
+	ctx, cancel := withTimeout(ctx, q.timeout)
+	defer cancel()
+
+	var stats JobQueueStats
+	err := q.db.QueryRowContext(ctx, `
+		SELECT
+			COUNT(*) FILTER (WHERE leased_by = '' OR available_at <= $1),
+			COUNT(*) FILTER (WHERE leased_by <> '' AND available_at > $1),
+			(SELECT COUNT(*) FROM url_jobs_dead)
+		FROM url_jobs
+	`, now.UTC()).Scan(&stats.Queued, &stats.Leased, &stats.Dead)
+	if err != nil {
+		return JobQueueStats{}, err
+	}
+
+	return stats, nil
+}
@@ -1,32 +1,64 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type PostgresURLStore struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts QueryTimeouts
+}
+
+// QueryTimeouts bounds how long each PostgresURLStore operation may spend in
+// the database, on top of any deadline the caller's context already has.
+// A zero duration adds no bound.
+type QueryTimeouts struct {
+	Set          time.Duration
+	Get          time.Duration
+	Lookup       time.Duration
+	GetByUser    time.Duration
+	Update       time.Duration
+	SetMetadata  time.Duration
+	DueForCheck  time.Duration
+	Delete       time.Duration
+	PurgeExpired time.Duration
+	Stats        time.Duration
+	// Jobs bounds each operation of the store's JobQueue.
+	Jobs time.Duration
+}
+
+// DefaultQueryTimeouts keeps redirects snappy and gives the periodic purge,
+// which may delete many rows, more room.
+var DefaultQueryTimeouts = QueryTimeouts{
+	Set:          5 * time.Second,
+	Get:          time.Second,
+	Lookup:       time.Second,
+	GetByUser:    5 * time.Second,
+	Update:       5 * time.Second,
+	SetMetadata:  5 * time.Second,
+	DueForCheck:  5 * time.Second,
+	Delete:       5 * time.Second,
+	PurgeExpired: 30 * time.Second,
+	Stats:        5 * time.Second,
+	Jobs:         5 * time.Second,
 }
 
 func NewPostgresURLStore(connStr string) (*PostgresURLStore, error) {
-	db, err := sql.Open("postgres", connStr)
+	db, err := openPostgres(connStr)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
-	}
-
-	if err := db.Ping(); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to connect to database: %w", err)
+		return nil, err
 	}
 
 	store := &PostgresURLStore{
-		db: db,
+		db:       db,
+		timeouts: DefaultQueryTimeouts,
 	}
 
 	if err := store.initSchema(); err != nil {
@@ -37,27 +69,32 @@ func NewPostgresURLStore(connStr string) (*PostgresURLStore, error) {
 	return store, nil
 }
 
+func openPostgres(connStr string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
 func (s *PostgresURLStore) initSchema() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS urls (
-			code TEXT PRIMARY KEY,
-			url TEXT NOT NULL,
-			user_id TEXT NOT NULL,
-			created_at TIMESTAMP NOT NULL
-		)
-	`)
+	migrator, err := NewMigrator(s.db)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.db.Exec(`
-		CREATE INDEX IF NOT EXISTS idx_urls_user_id ON urls(user_id)
-	`)
+	applied, err := migrator.Up()
 	if err != nil {
 		return err
 	}
 
-	log.Println("Database schema initialized successfully")
+	log.Printf("Database schema initialized successfully (%d migrations applied)", applied)
 	return nil
 }
 
@@ -65,99 +102,288 @@ func (s *PostgresURLStore) Close() error {
 	return s.db.Close()
 }
 
-func validateAlias(alias string) error {
-	if len(alias) < 3 || len(alias) > 20 {
-		return ErrInvalidAlias
-	}
+func (s *PostgresURLStore) SetQueryTimeouts(timeouts QueryTimeouts) {
+	s.timeouts = timeouts
+}
 
-	match, err := regexp.MatchString("^[a-zA-Z0-9]+$", alias)
-	if err != nil || !match {
-		return ErrInvalidAlias
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
-
-	return nil
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (s *PostgresURLStore) Set(url string) (string, error) {
-	return s.SetWithOptions(url, "", "")
+func (s *PostgresURLStore) Set(ctx context.Context, url string) (string, error) {
+	code, _, err := s.SetWithOptions(ctx, url, SetOptions{})
+	return code, err
 }
 
-func (s *PostgresURLStore) SetWithOptions(url, customAlias, userID string) (string, error) {
+func (s *PostgresURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
 	if url == "" {
-		return "", ErrInvalidURL
+		return "", false, ErrInvalidURL
 	}
 
+	ctx, cancel := withTimeout(ctx, s.timeouts.Set)
+	defer cancel()
+
+	customAlias := opts.Alias
+	userID := opts.UserID
 	if userID == "" {
 		userID = "anonymous"
 	}
 
-	var code string
-	var err error
+	var expiresAt sql.NullTime
+	if !opts.ExpiresAt.IsZero() {
+		expiresAt = sql.NullTime{Time: opts.ExpiresAt.UTC(), Valid: true}
+	}
+
+	var clicksRemaining sql.NullInt64
+	if opts.MaxClicks > 0 {
+		clicksRemaining = sql.NullInt64{Int64: int64(opts.MaxClicks), Valid: true}
+	}
+
+	var urlKey sql.NullString
+	if key := opts.dedupeKey(url); key != "" {
+		urlKey = sql.NullString{String: key, Valid: true}
+	}
+
+	insert := func(code string) (bool, error) {
+		return s.insertURL(ctx, code, url, userID, customAlias != "", expiresAt, clicksRemaining, urlKey)
+	}
 
 	if customAlias != "" {
-		if err := validateAlias(customAlias); err != nil {
-			return "", err
+		inserted, err := insert(customAlias)
+		if err != nil {
+			return "", false, err
+		}
+		if !inserted {
+			return "", false, ErrAliasInUse
 		}
 
-		var exists bool
-		err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM urls WHERE code = $1)", customAlias).Scan(&exists)
-		if err != nil {
-			return "", err
+		return customAlias, false, nil
+	}
+
+	if urlKey.Valid {
+		existing, err := s.findURLKey(ctx, userID, urlKey.String)
+		if err != nil || existing != "" {
+			return existing, existing != "", err
 		}
-		if exists {
-			return "", ErrAliasInUse
+	}
+
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, err := generateCode(ctx, opts.Generator)
+		if err != nil {
+			return "", false, err
 		}
 
-		code = customAlias
-	} else {
-		code, err = generateCode()
+		inserted, err := insert(code)
 		if err != nil {
-			return "", err
+			return "", false, err
+		}
+		if inserted {
+			return code, false, nil
 		}
 
-		for {
-			var exists bool
-			err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM urls WHERE code = $1)", code).Scan(&exists)
-			if err != nil {
-				return "", err
-			}
-			if !exists {
-				break
-			}
-			code, err = generateCode()
-			if err != nil {
-				return "", err
+		// The conflict may have been on the URL key rather than the code,
+		// if a concurrent request deduplicated the same URL first.
+		if urlKey.Valid {
+			existing, err := s.findURLKey(ctx, userID, urlKey.String)
+			if err != nil || existing != "" {
+				return existing, existing != "", err
 			}
 		}
 	}
 
-	_, err = s.db.Exec(
-		"INSERT INTO urls (code, url, user_id, created_at) VALUES ($1, $2, $3, $4)",
-		code, url, userID, time.Now(),
-	)
+	return "", false, ErrCodeSpaceExhausted
+}
+
+// insertURL inserts a row unless the code, or the user's URL key when one
+// is given, is already taken, reporting whether it was inserted. Relying on
+// the unique indexes rather than checking first means concurrent requests
+// for the same code or URL cannot both succeed.
+func (s *PostgresURLStore) insertURL(ctx context.Context, code, url, userID string, alias bool, expiresAt sql.NullTime, clicksRemaining sql.NullInt64, urlKey sql.NullString) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO urls (code, url, user_id, created_at, expires_at, clicks_remaining, url_key, alias)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING
+	`, code, url, userID, time.Now(), expiresAt, clicksRemaining, urlKey, alias)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return "", err
+		return false, err
 	}
 
-	return code, nil
+	return affected > 0, nil
 }
 
-func (s *PostgresURLStore) Get(code string) (string, error) {
-	var url string
-	err := s.db.QueryRow("SELECT url FROM urls WHERE code = $1", code).Scan(&url)
+// findURLKey returns the code of the user's link deduplicated under urlKey,
+// or "" if there is none.
+func (s *PostgresURLStore) findURLKey(ctx context.Context, userID, urlKey string) (string, error) {
+	var code string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT code FROM urls WHERE user_id = $1 AND url_key = $2",
+		userID, urlKey,
+	).Scan(&code)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+
+	return code, err
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func (s *PostgresURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := s.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+func (s *PostgresURLStore) Resolve(ctx context.Context, code string) (URLEntry, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Get)
+	defer cancel()
+
+	now := time.Now()
+	entry, err := s.lookup(ctx, code)
+	if err != nil {
+		return URLEntry{}, err
+	}
+	if entry.Expired(now) {
+		return URLEntry{}, ErrCodeExpired
+	}
+	if entry.ClicksRemaining == nil {
+		return entry, nil
+	}
+
+	// The conditional decrement is atomic, so concurrent visits racing on
+	// the last click cannot both succeed. It rechecks the expiry, since the
+	// link may have expired since the lookup.
+	var remaining int
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE urls SET clicks_remaining = clicks_remaining - 1
+		WHERE code = $1 AND clicks_remaining > 0 AND (expires_at IS NULL OR expires_at > $2)
+		RETURNING url, clicks_remaining
+	`, code, now.UTC()).Scan(&entry.URL, &remaining)
+	if err == sql.ErrNoRows {
+		return URLEntry{}, s.unconsumable(ctx, code, now)
+	}
+	if err != nil {
+		return URLEntry{}, err
+	}
+	entry.ClicksRemaining = &remaining
+
+	return entry, nil
+}
+
+// unconsumable explains why a click on code could not be consumed: the link
+// was deleted, it expired or its clicks ran out.
+func (s *PostgresURLStore) unconsumable(ctx context.Context, code string, now time.Time) error {
+	entry, err := s.lookup(ctx, code)
+	if err != nil {
+		return err
+	}
+	if entry.Expired(now) {
+		return ErrCodeExpired
+	}
+
+	return ErrClicksExhausted
+}
+
+func (s *PostgresURLStore) Lookup(ctx context.Context, code string) (URLEntry, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Lookup)
+	defer cancel()
+
+	return s.lookup(ctx, code)
+}
+
+func (s *PostgresURLStore) lookup(ctx context.Context, code string) (URLEntry, error) {
+	entry, err := scanURLEntry(s.db.QueryRowContext(ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE code = $1",
+		code,
+	))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", ErrCodeNotFound
+			return URLEntry{}, ErrCodeNotFound
 		}
-		return "", err
+		return URLEntry{}, err
 	}
 
-	return url, nil
+	return entry, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func (s *PostgresURLStore) GetByUser(userID string) ([]URLEntry, error) {
-	rows, err := s.db.Query(
-		"SELECT code, url, created_at FROM urls WHERE user_id = $1 ORDER BY created_at DESC",
+// urlColumns are the columns scanURLEntry reads, in order.
+const urlColumns = `code, url, user_id, created_at, expires_at, clicks_remaining, alias,
+	checked_at, check_status, check_status_code, content_type, title, check_error,
+	description, image_url, favicon_url,
+	health, health_since, check_failures, next_check_at`
+
+func scanURLEntry(row rowScanner) (URLEntry, error) {
+	var entry URLEntry
+	var expiresAt, checkedAt sql.NullTime
+	var clicksRemaining, statusCode sql.NullInt64
+	var status, contentType, title, checkError sql.NullString
+	var description, imageURL, faviconURL, health sql.NullString
+	var healthSince, nextCheckAt sql.NullTime
+	var failures int
+	err := row.Scan(
+		&entry.Code, &entry.URL, &entry.UserID, &entry.CreatedAt, &expiresAt, &clicksRemaining, &entry.Alias,
+		&checkedAt, &status, &statusCode, &contentType, &title, &checkError,
+		&description, &imageURL, &faviconURL,
+		&health, &healthSince, &failures, &nextCheckAt,
+	)
+	if err != nil {
+		return URLEntry{}, err
+	}
+	if expiresAt.Valid {
+		entry.ExpiresAt = &expiresAt.Time
+	}
+	if clicksRemaining.Valid {
+		remaining := int(clicksRemaining.Int64)
+		entry.ClicksRemaining = &remaining
+	}
+	if checkedAt.Valid {
+		entry.Metadata = &LinkMetadata{
+			CheckedAt:   checkedAt.Time,
+			Status:      status.String,
+			StatusCode:  int(statusCode.Int64),
+			ContentType: contentType.String,
+			Title:       title.String,
+			Description: description.String,
+			ImageURL:    imageURL.String,
+			FaviconURL:  faviconURL.String,
+			Error:       checkError.String,
+			Health:      health.String,
+			Failures:    failures,
+		}
+		if healthSince.Valid {
+			entry.Metadata.HealthSince = &healthSince.Time
+		}
+		if nextCheckAt.Valid {
+			entry.Metadata.NextCheckAt = &nextCheckAt.Time
+		}
+	}
+
+	return entry, nil
+}
+
+func (s *PostgresURLStore) GetByUser(ctx context.Context, userID string) ([]URLEntry, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.GetByUser)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE user_id = $1 ORDER BY created_at DESC",
 		userID,
 	)
 	if err != nil {
@@ -165,18 +391,13 @@ func (s *PostgresURLStore) GetByUser(userID string) ([]URLEntry, error) {
 	}
 	defer rows.Close()
 
-	var entries []URLEntry
+	entries := []URLEntry{}
 	for rows.Next() {
-		var code, url string
-		var createdAt time.Time
-		if err := rows.Scan(&code, &url, &createdAt); err != nil {
+		entry, err := scanURLEntry(rows)
+		if err != nil {
 			return nil, err
 		}
-		entries = append(entries, URLEntry{
-			Code:      code,
-			URL:       url,
-			CreatedAt: createdAt,
-		})
+		entries = append(entries, entry)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -186,9 +407,234 @@ func (s *PostgresURLStore) GetByUser(userID string) ([]URLEntry, error) {
 	return entries, nil
 }
 
-func (s *PostgresURLStore) Stats() int {
+func (s *PostgresURLStore) Update(ctx context.Context, code, url, userID string) error {
+	if url == "" {
+		return ErrInvalidURL
+	}
+
+	ctx, cancel := withTimeout(ctx, s.timeouts.Update)
+	defer cancel()
+
+	// Clearing url_key takes the link out of deduplication, since it no
+	// longer points at the URL it was registered under.
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE urls SET url = $1, url_key = NULL,
+			checked_at = NULL, check_status = NULL, check_status_code = NULL,
+			content_type = NULL, title = NULL, check_error = NULL,
+			description = NULL, image_url = NULL, favicon_url = NULL,
+			health = NULL, health_since = NULL, check_failures = 0, next_check_at = NULL
+		WHERE code = $2 AND user_id = $3
+	`, url, code, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.checkOwnedChange(ctx, result, code)
+}
+
+func (s *PostgresURLStore) SetMetadata(ctx context.Context, code, url string, meta LinkMetadata) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.SetMetadata)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE urls SET checked_at = $3, check_status = $4, check_status_code = $5,
+			content_type = $6, title = $7, check_error = $8,
+			description = $9, image_url = $10, favicon_url = $11,
+			health = $12, health_since = $13, check_failures = $14, next_check_at = $15
+		WHERE code = $1 AND url = $2
+	`, code, url, meta.CheckedAt.UTC(), meta.Status, nullInt(meta.StatusCode),
+		nullString(meta.ContentType), nullString(meta.Title), nullString(meta.Error),
+		nullString(meta.Description), nullString(meta.ImageURL), nullString(meta.FaviconURL),
+		nullString(meta.Health), nullTime(meta.HealthSince), meta.Failures, nullTime(meta.NextCheckAt))
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// Either the link is gone or it points elsewhere now.
+	var exists bool
+	err = s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM urls WHERE code = $1)", code).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrCodeNotFound
+	}
+
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func nullInt(n int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(n), Valid: n != 0}
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
+
+func (s *PostgresURLStore) DueForCheck(ctx context.Context, now time.Time, limit int) ([]URLEntry, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.DueForCheck)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+urlColumns+` FROM urls
+		WHERE COALESCE(next_check_at, created_at) <= $1
+			AND (expires_at IS NULL OR expires_at > $1)
+			AND (clicks_remaining IS NULL OR clicks_remaining > 0)
+		ORDER BY COALESCE(next_check_at, created_at)
+		LIMIT $2
+	`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []URLEntry{}
+	for rows.Next() {
+		entry, err := scanURLEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (s *PostgresURLStore) Delete(ctx context.Context, code, userID string) error {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Delete)
+	defer cancel()
+
+	// The clicks and checks go in the same statement, like PurgeExpired's.
+	var deleted int
+	err := s.db.QueryRowContext(ctx, `
+		WITH deleted AS (
+			DELETE FROM urls WHERE code = $1 AND user_id = $2 RETURNING code
+		), deleted_clicks AS (
+			DELETE FROM clicks WHERE code IN (SELECT code FROM deleted)
+		), deleted_checks AS (
+			DELETE FROM link_checks WHERE code IN (SELECT code FROM deleted)
+		)
+		SELECT COUNT(*) FROM deleted
+	`, code, userID).Scan(&deleted)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		return nil
+	}
+
+	return s.unowned(ctx, code)
+}
+
+// checkOwnedChange inspects the result of a statement restricted to the
+// owner's rows and, when nothing changed, reports why.
+func (s *PostgresURLStore) checkOwnedChange(ctx context.Context, result sql.Result, code string) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	return s.unowned(ctx, code)
+}
+
+// unowned explains why the owner's change to code matched no rows: the code
+// is missing or belongs to someone else.
+func (s *PostgresURLStore) unowned(ctx context.Context, code string) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM urls WHERE code = $1)", code).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrNotOwner
+	}
+
+	return ErrCodeNotFound
+}
+
+func (s *PostgresURLStore) PurgeExpired(ctx context.Context) (int, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.PurgeExpired)
+	defer cancel()
+
+	// The clicks and checks go in the same statement, or whoever next
+	// claims an expired alias would inherit them.
+	var removed int
+	err := s.db.QueryRowContext(ctx, `
+		WITH purged AS (
+			DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at <= $1 RETURNING code
+		), purged_clicks AS (
+			DELETE FROM clicks WHERE code IN (SELECT code FROM purged)
+		), purged_checks AS (
+			DELETE FROM link_checks WHERE code IN (SELECT code FROM purged)
+		)
+		SELECT COUNT(*) FROM purged
+	`, time.Now()).Scan(&removed)
+	if err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+func (s *PostgresURLStore) NextSequence(ctx context.Context) (uint64, error) {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Set)
+	defer cancel()
+
+	var n int64
+	if err := s.db.QueryRowContext(ctx, "SELECT nextval('url_code_seq')").Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return uint64(n), nil
+}
+
+// EachCode streams every code in the table. It is not bounded by a query
+// timeout, since it scales with the size of the table; callers should pass
+// a context they can cancel.
+func (s *PostgresURLStore) EachCode(ctx context.Context, fn func(code string) error) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT code FROM urls")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return err
+		}
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *PostgresURLStore) Stats(ctx context.Context) int {
+	ctx, cancel := withTimeout(ctx, s.timeouts.Stats)
+	defer cancel()
+
 	var count int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM urls").Scan(&count)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM urls").Scan(&count)
 	if err != nil {
 		log.Printf("Error getting stats: %v", err)
 		return 0
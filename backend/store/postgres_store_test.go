@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestPostgresStore connects to the database named by TEST_DATABASE_URL,
+// skipping the test when it is not set.
+func newTestPostgresStore(t *testing.T) *PostgresURLStore {
+	t.Helper()
+
+	connStr := os.Getenv("TEST_DATABASE_URL")
+	if connStr == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	store, err := NewPostgresURLStore(connStr)
+	if err != nil {
+		t.Fatalf("Failed to connect to PostgreSQL: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Close()
+	})
+
+	return store
+}
+
+func TestPostgresURLStore_AliasPolicy(t *testing.T) {
+	testAliasConformance(t, NewValidatingURLStore(newTestPostgresStore(t), DefaultAliasPolicy))
+}
+
+func TestPostgresURLStore_PurgeForgetsHistory(t *testing.T) {
+	store := newTestPostgresStore(t)
+	testPurgeForgetsHistory(t, store, store.ClickStore(), store.CheckStore())
+}
+
+func TestPostgresURLStore_QueryTimeout(t *testing.T) {
+	store := newTestPostgresStore(t)
+
+	code, err := store.Set(context.Background(), "https://example.com")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Delete(context.Background(), code, "anonymous")
+	})
+
+	timeouts := DefaultQueryTimeouts
+	timeouts.Get = time.Nanosecond
+	store.SetQueryTimeouts(timeouts)
+
+	if _, err := store.Get(context.Background(), code); err == nil {
+		t.Error("Expected Get to fail once its timeout has passed")
+	}
+	if _, err := store.Lookup(context.Background(), code); err != nil {
+		t.Errorf("Expected Lookup to keep its own timeout, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Reaper periodically purges expired links from a URLStore.
+type Reaper struct {
+	store    URLStore
+	interval time.Duration
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+func NewReaper(store URLStore, interval time.Duration) *Reaper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	reaper := &Reaper{
+		store:    store,
+		interval: interval,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	reaper.wg.Add(1)
+	go reaper.run()
+
+	return reaper
+}
+
+func (r *Reaper) run() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := r.store.PurgeExpired(r.ctx)
+			if err != nil {
+				log.Printf("Error purging expired URLs: %v", err)
+				continue
+			}
+			if removed > 0 {
+				log.Printf("Purged %d expired URLs", removed)
+			}
+		}
+	}
+}
+
+func (r *Reaper) Stop() {
+	r.cancel()
+	r.wg.Wait()
+}
@@ -1,38 +1,110 @@
 package store
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/codegen"
 )
 
 var (
-	ErrCodeNotFound = errors.New("code not found")
-	ErrInvalidURL   = errors.New("invalid URL")
-	ErrAliasInUse   = errors.New("custom alias is already in use")
-	ErrInvalidAlias = errors.New("invalid alias: must be 3-20 alphanumeric characters")
+	ErrCodeNotFound       = errors.New("code not found")
+	ErrCodeExpired        = errors.New("code has expired")
+	ErrClicksExhausted    = errors.New("code has reached its click limit")
+	ErrNotOwner           = errors.New("code is owned by another user")
+	ErrCodeSpaceExhausted = errors.New("failed to generate an unused code")
+	ErrInvalidURL         = errors.New("invalid URL")
+	ErrAliasInUse         = errors.New("custom alias is already in use")
+	ErrInvalidAlias       = errors.New("invalid alias: must be 3-20 alphanumeric characters")
+	ErrReservedAlias      = errors.New("alias is reserved")
 )
 
 type URLEntry struct {
-	Code      string    `json:"code"`
-	URL       string    `json:"url"`
-	UserID    string    `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	UserID    string     `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Alias is set for links whose code was chosen by the user, which
+	// unlike generated codes are resolved case-insensitively.
+	Alias bool `json:"alias,omitempty"`
+	// ClicksRemaining is nil for links without a click limit.
+	ClicksRemaining *int `json:"clicks_remaining,omitempty"`
+	// Metadata is nil until the destination has been checked.
+	Metadata *LinkMetadata `json:"metadata,omitempty"`
+}
+
+// Expired reports whether the entry has an expiry that is at or before now.
+func (e URLEntry) Expired(now time.Time) bool {
+	return e.ExpiresAt != nil && !now.Before(*e.ExpiresAt)
+}
+
+// SetOptions holds the optional parameters accepted by SetWithOptions.
+// A zero ExpiresAt means the link never expires and a zero MaxClicks means
+// the link can be visited any number of times. Generator picks the code
+// when no Alias is given; nil means DefaultGenerator.
+//
+// With Dedupe set, a plain link (no alias, expiry or click limit) to a URL
+// the user has already shortened that way returns the existing code, with
+// URLs compared by URLKey.
+type SetOptions struct {
+	Alias     string
+	UserID    string
+	ExpiresAt time.Time
+	MaxClicks int
+	Generator codegen.Generator
+	Dedupe    bool
 }
 
+// URLStore persists short links. Every method takes the caller's context;
+// implementations that do I/O stop and return ctx.Err() once it is done.
 type URLStore interface {
-	Set(url string) (string, error)
-	SetWithOptions(url, customAlias, userID string) (string, error)
-	Get(code string) (string, error)
-	GetByUser(userID string) ([]URLEntry, error)
-	Stats() int
+	Set(ctx context.Context, url string) (string, error)
+	// SetWithOptions creates a link and returns its code. existing is true
+	// when opts.Dedupe matched a link the user already had instead.
+	SetWithOptions(ctx context.Context, url string, opts SetOptions) (code string, existing bool, err error)
+	// Get resolves a code for a visit, consuming one click from links
+	// that have a click limit.
+	Get(ctx context.Context, code string) (string, error)
+	// Resolve is Get returning the stored entry, whose Code may differ
+	// from code in wrappers that match codes loosely, so a visit needs only
+	// one call. A limited entry's ClicksRemaining counts this visit.
+	Resolve(ctx context.Context, code string) (URLEntry, error)
+	// Lookup returns the entry for a code without counting a visit.
+	Lookup(ctx context.Context, code string) (URLEntry, error)
+	// GetByUser returns the links owned by userID, newest first.
+	GetByUser(ctx context.Context, userID string) ([]URLEntry, error)
+	// Update changes the destination of a code owned by userID, clearing
+	// its metadata.
+	Update(ctx context.Context, code, url, userID string) error
+	// SetMetadata records the result of checking url for code. It does
+	// nothing if the link has since been pointed elsewhere, so a slow check
+	// cannot overwrite the metadata of the new destination.
+	SetMetadata(ctx context.Context, code, url string, meta LinkMetadata) error
+	// DueForCheck returns up to limit live links whose destination is due
+	// for a check at now, most overdue first. A link is due at its
+	// Metadata.NextCheckAt, or at its creation until a check sets one.
+	DueForCheck(ctx context.Context, now time.Time, limit int) ([]URLEntry, error)
+	// Delete removes a code owned by userID along with its clicks and
+	// checks.
+	Delete(ctx context.Context, code, userID string) error
+	PurgeExpired(ctx context.Context) (int, error)
+	Stats(ctx context.Context) int
 }
 
 type InMemoryURLStore struct {
 	urls     map[string]URLEntry
 	userURLs map[string][]string
+	// dedupe maps userDedupeKey(user, URLKey) to the code of the user's
+	// deduplicated link for that URL.
+	dedupe   map[string]string
+	apiKeys  map[string]APIKey
+	clicks   *InMemoryClickStore
+	checks   *InMemoryCheckStore
+	sequence atomic.Uint64
 	mutex    sync.RWMutex
 }
 
@@ -40,90 +112,184 @@ func NewInMemoryURLStore() *InMemoryURLStore {
 	return &InMemoryURLStore{
 		urls:     make(map[string]URLEntry),
 		userURLs: make(map[string][]string),
+		dedupe:   make(map[string]string),
+		apiKeys:  make(map[string]APIKey),
+		clicks:   NewInMemoryClickStore(),
+		checks:   NewInMemoryCheckStore(),
 	}
 }
 
-func generateCode() (string, error) {
-	b := make([]byte, 6)
-	_, err := rand.Read(b)
+// ClickStore returns the store's clicks, which Delete and PurgeExpired
+// remove along with their links.
+func (s *InMemoryURLStore) ClickStore() *InMemoryClickStore {
+	return s.clicks
+}
+
+// CheckStore returns the store's link checks, which Delete and
+// PurgeExpired remove along with their links.
+func (s *InMemoryURLStore) CheckStore() *InMemoryCheckStore {
+	return s.checks
+}
+
+// maxCodeAttempts bounds the retries when a generated code collides with an
+// existing one, which only becomes likely when the code space is nearly full.
+const maxCodeAttempts = 10
+
+// DefaultGenerator issues 8 random base62 characters, about 47 bits.
+var DefaultGenerator codegen.Generator = mustRandom(codegen.Base62, 8)
+
+func mustRandom(alphabet string, length int) *codegen.Random {
+	generator, err := codegen.NewRandom(alphabet, length)
 	if err != nil {
-		return "", err
+		panic(err)
 	}
+	return generator
+}
 
-	code := base64.URLEncoding.EncodeToString(b)
-	if len(code) > 8 {
-		code = code[:8]
+func generateCode(ctx context.Context, generator codegen.Generator) (string, error) {
+	if generator == nil {
+		generator = DefaultGenerator
 	}
-
-	return code, nil
+	return generator.Generate(ctx)
 }
 
-func (s *InMemoryURLStore) Set(url string) (string, error) {
-	return s.SetWithOptions(url, "", "anonymous")
+func (s *InMemoryURLStore) Set(ctx context.Context, url string) (string, error) {
+	code, _, err := s.SetWithOptions(ctx, url, SetOptions{UserID: "anonymous"})
+	return code, err
 }
 
-func (s *InMemoryURLStore) SetWithOptions(url, customAlias, userID string) (string, error) {
+func (s *InMemoryURLStore) SetWithOptions(ctx context.Context, url string, opts SetOptions) (string, bool, error) {
 	if url == "" {
-		return "", ErrInvalidURL
+		return "", false, ErrInvalidURL
 	}
 
+	customAlias := opts.Alias
+	userID := opts.UserID
 	if userID == "" {
 		userID = "anonymous"
 	}
 
+	var dedupeKey string
+	if key := opts.dedupeKey(url); key != "" {
+		dedupeKey = userDedupeKey(userID, key)
+	}
+
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	if code, exists := s.dedupe[dedupeKey]; dedupeKey != "" && exists {
+		return code, true, nil
+	}
+
 	var code string
 	var err error
 
 	if customAlias != "" {
 		if _, exists := s.urls[customAlias]; exists {
-			return "", ErrAliasInUse
+			return "", false, ErrAliasInUse
 		}
 		code = customAlias
 	} else {
-		code, err = generateCode()
-		if err != nil {
-			return "", err
-		}
-
-		for {
-			if _, exists := s.urls[code]; !exists {
-				break
+		for attempt := 0; ; attempt++ {
+			if attempt == maxCodeAttempts {
+				return "", false, ErrCodeSpaceExhausted
 			}
-			code, err = generateCode()
+			code, err = generateCode(ctx, opts.Generator)
 			if err != nil {
-				return "", err
+				return "", false, err
+			}
+			if _, exists := s.urls[code]; !exists {
+				break
 			}
 		}
 	}
 
-	s.urls[code] = URLEntry{
+	entry := URLEntry{
 		Code:      code,
 		URL:       url,
 		UserID:    userID,
 		CreatedAt: time.Now(),
+		Alias:     customAlias != "",
+	}
+	if !opts.ExpiresAt.IsZero() {
+		expiresAt := opts.ExpiresAt
+		entry.ExpiresAt = &expiresAt
 	}
+	if opts.MaxClicks > 0 {
+		remaining := opts.MaxClicks
+		entry.ClicksRemaining = &remaining
+	}
+	s.urls[code] = entry
 
 	s.userURLs[userID] = append(s.userURLs[userID], code)
+	if dedupeKey != "" {
+		s.dedupe[dedupeKey] = code
+	}
 
-	return code, nil
+	return code, false, nil
 }
 
-func (s *InMemoryURLStore) Get(code string) (string, error) {
+func (s *InMemoryURLStore) Get(ctx context.Context, code string) (string, error) {
+	entry, err := s.Resolve(ctx, code)
+	return entry.URL, err
+}
+
+func (s *InMemoryURLStore) Resolve(_ context.Context, code string) (URLEntry, error) {
+	s.mutex.RLock()
+	entry, exists := s.urls[code]
+	s.mutex.RUnlock()
+
+	if !exists {
+		return URLEntry{}, ErrCodeNotFound
+	}
+	if entry.Expired(time.Now()) {
+		return URLEntry{}, ErrCodeExpired
+	}
+	if entry.ClicksRemaining == nil {
+		return entry, nil
+	}
+
+	return s.consumeClick(code)
+}
+
+// consumeClick decrements the remaining clicks of a limited link under the
+// write lock, so concurrent visits can never overspend the limit. The link
+// is checked again, since it may have changed since Resolve's read.
+func (s *InMemoryURLStore) consumeClick(code string) (URLEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.urls[code]
+	if !exists {
+		return URLEntry{}, ErrCodeNotFound
+	}
+	if entry.Expired(time.Now()) {
+		return URLEntry{}, ErrCodeExpired
+	}
+	if *entry.ClicksRemaining <= 0 {
+		return URLEntry{}, ErrClicksExhausted
+	}
+
+	remaining := *entry.ClicksRemaining - 1
+	entry.ClicksRemaining = &remaining
+	s.urls[code] = entry
+
+	return entry, nil
+}
+
+func (s *InMemoryURLStore) Lookup(_ context.Context, code string) (URLEntry, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	entry, exists := s.urls[code]
 	if !exists {
-		return "", ErrCodeNotFound
+		return URLEntry{}, ErrCodeNotFound
 	}
 
-	return entry.URL, nil
+	return entry, nil
 }
 
-func (s *InMemoryURLStore) GetByUser(userID string) ([]URLEntry, error) {
+func (s *InMemoryURLStore) GetByUser(_ context.Context, userID string) ([]URLEntry, error) {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
@@ -132,9 +298,10 @@ func (s *InMemoryURLStore) GetByUser(userID string) ([]URLEntry, error) {
 		return []URLEntry{}, nil
 	}
 
+	// codes is in creation order; walk it backwards for newest first.
 	entries := make([]URLEntry, 0, len(codes))
-	for _, code := range codes {
-		if entry, ok := s.urls[code]; ok {
+	for i := len(codes) - 1; i >= 0; i-- {
+		if entry, ok := s.urls[codes[i]]; ok {
 			entries = append(entries, entry)
 		}
 	}
@@ -142,9 +309,218 @@ func (s *InMemoryURLStore) GetByUser(userID string) ([]URLEntry, error) {
 	return entries, nil
 }
 
-func (s *InMemoryURLStore) Stats() int {
+func (s *InMemoryURLStore) Update(_ context.Context, code, url, userID string) error {
+	if url == "" {
+		return ErrInvalidURL
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.urls[code]
+	if !exists {
+		return ErrCodeNotFound
+	}
+	if entry.UserID != userID {
+		return ErrNotOwner
+	}
+
+	// The link no longer points at the URL it was deduplicated under.
+	s.forgetDedupe(entry)
+	entry.URL = url
+	entry.Metadata = nil
+	s.urls[code] = entry
+
+	return nil
+}
+
+func (s *InMemoryURLStore) SetMetadata(_ context.Context, code, url string, meta LinkMetadata) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.urls[code]
+	if !exists {
+		return ErrCodeNotFound
+	}
+	if entry.URL != url {
+		return nil
+	}
+
+	entry.Metadata = &meta
+	s.urls[code] = entry
+
+	return nil
+}
+
+func (s *InMemoryURLStore) DueForCheck(_ context.Context, now time.Time, limit int) ([]URLEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries := make([]URLEntry, 0, len(s.urls))
+	for _, entry := range s.urls {
+		entries = append(entries, entry)
+	}
+
+	return dueEntries(entries, now, limit), nil
+}
+
+func (s *InMemoryURLStore) Delete(_ context.Context, code, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.urls[code]
+	if !exists {
+		return ErrCodeNotFound
+	}
+	if entry.UserID != userID {
+		return ErrNotOwner
+	}
+
+	delete(s.urls, code)
+	s.forgetDedupe(entry)
+	s.clicks.DeleteClicks(code)
+	s.checks.DeleteChecks(code)
+
+	codes := s.userURLs[userID]
+	for i, c := range codes {
+		if c == code {
+			codes = append(codes[:i], codes[i+1:]...)
+			break
+		}
+	}
+	if len(codes) == 0 {
+		delete(s.userURLs, userID)
+	} else {
+		s.userURLs[userID] = codes
+	}
+
+	return nil
+}
+
+// forgetDedupe drops entry from the dedupe index if it is registered there.
+// The caller must hold s.mutex for writing.
+func (s *InMemoryURLStore) forgetDedupe(entry URLEntry) {
+	key := userDedupeKey(entry.UserID, URLKey(entry.URL))
+	if s.dedupe[key] == entry.Code {
+		delete(s.dedupe, key)
+	}
+}
+
+func (s *InMemoryURLStore) PurgeExpired(_ context.Context) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	removed := 0
+	affected := make(map[string]bool)
+	for code, entry := range s.urls {
+		if entry.Expired(now) {
+			delete(s.urls, code)
+			// Whoever next claims an expired alias must not inherit its
+			// clicks and checks.
+			s.clicks.DeleteClicks(code)
+			s.checks.DeleteChecks(code)
+			affected[entry.UserID] = true
+			removed++
+		}
+	}
+
+	for userID := range affected {
+		codes := s.userURLs[userID]
+		kept := codes[:0]
+		for _, code := range codes {
+			if _, ok := s.urls[code]; ok {
+				kept = append(kept, code)
+			}
+		}
+		if len(kept) == 0 {
+			delete(s.userURLs, userID)
+		} else {
+			s.userURLs[userID] = kept
+		}
+	}
+
+	return removed, nil
+}
+
+func (s *InMemoryURLStore) NextSequence(_ context.Context) (uint64, error) {
+	return s.sequence.Add(1), nil
+}
+
+func (s *InMemoryURLStore) EachCode(_ context.Context, fn func(code string) error) error {
+	s.mutex.RLock()
+	codes := make([]string, 0, len(s.urls))
+	for code := range s.urls {
+		codes = append(codes, code)
+	}
+	s.mutex.RUnlock()
+
+	for _, code := range codes {
+		if err := fn(code); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *InMemoryURLStore) Stats(_ context.Context) int {
 	s.mutex.RLock()
 	defer s.mutex.RUnlock()
 
 	return len(s.urls)
 }
+
+func (s *InMemoryURLStore) CreateAPIKey(key APIKey) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.apiKeys[key.Hash] = key
+
+	return nil
+}
+
+func (s *InMemoryURLStore) LookupAPIKey(hash string) (APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	key, exists := s.apiKeys[hash]
+	if !exists {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+
+	return key, nil
+}
+
+func (s *InMemoryURLStore) ListAPIKeys(userID string) ([]APIKey, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	keys := []APIKey{}
+	for _, key := range s.apiKeys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	sortAPIKeys(keys)
+
+	return keys, nil
+}
+
+func (s *InMemoryURLStore) RevokeAPIKey(id, userID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for hash, key := range s.apiKeys {
+		if key.ID != id {
+			continue
+		}
+		if key.UserID != userID {
+			return ErrNotOwner
+		}
+		delete(s.apiKeys, hash)
+		return nil
+	}
+
+	return ErrAPIKeyNotFound
+}
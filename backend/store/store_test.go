@@ -1,7 +1,10 @@
 package store
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestInMemoryURLStore_Set(t *testing.T) {
@@ -9,7 +12,7 @@ func TestInMemoryURLStore_Set(t *testing.T) {
 	
 	// Test valid URL
 	url := "https://example.com"
-	code, err := store.Set(url)
+	code, err := store.Set(context.Background(), url)
 	if err != nil {
 		t.Errorf("Failed to set URL: %v", err)
 	}
@@ -18,14 +21,14 @@ func TestInMemoryURLStore_Set(t *testing.T) {
 	}
 	
 	// Test empty URL
-	_, err = store.Set("")
+	_, err = store.Set(context.Background(), "")
 	if err != ErrInvalidURL {
 		t.Errorf("Expected ErrInvalidURL, got %v", err)
 	}
 	
 	// Test multiple URLs
 	url2 := "https://example.org"
-	code2, err := store.Set(url2)
+	code2, err := store.Set(context.Background(), url2)
 	if err != nil {
 		t.Errorf("Failed to set second URL: %v", err)
 	}
@@ -39,13 +42,13 @@ func TestInMemoryURLStore_Get(t *testing.T) {
 	
 	// Set a URL
 	url := "https://example.com"
-	code, err := store.Set(url)
+	code, err := store.Set(context.Background(), url)
 	if err != nil {
 		t.Fatalf("Failed to set URL: %v", err)
 	}
 	
 	// Get the URL
-	retrievedURL, err := store.Get(code)
+	retrievedURL, err := store.Get(context.Background(), code)
 	if err != nil {
 		t.Errorf("Failed to get URL: %v", err)
 	}
@@ -54,7 +57,7 @@ func TestInMemoryURLStore_Get(t *testing.T) {
 	}
 	
 	// Test non-existent code
-	_, err = store.Get("nonexistent")
+	_, err = store.Get(context.Background(), "nonexistent")
 	if err != ErrCodeNotFound {
 		t.Errorf("Expected ErrCodeNotFound, got %v", err)
 	}
@@ -64,29 +67,221 @@ func TestInMemoryURLStore_Stats(t *testing.T) {
 	store := NewInMemoryURLStore()
 	
 	// Initial stats should be 0
-	if stats := store.Stats(); stats != 0 {
+	if stats := store.Stats(context.Background()); stats != 0 {
 		t.Errorf("Expected 0 URLs, got %d", stats)
 	}
 	
 	// Add a URL
-	_, err := store.Set("https://example.com")
+	_, err := store.Set(context.Background(), "https://example.com")
 	if err != nil {
 		t.Fatalf("Failed to set URL: %v", err)
 	}
 	
 	// Stats should be 1
-	if stats := store.Stats(); stats != 1 {
+	if stats := store.Stats(context.Background()); stats != 1 {
 		t.Errorf("Expected 1 URL, got %d", stats)
 	}
 	
 	// Add another URL
-	_, err = store.Set("https://example.org")
+	_, err = store.Set(context.Background(), "https://example.org")
 	if err != nil {
 		t.Fatalf("Failed to set URL: %v", err)
 	}
 	
 	// Stats should be 2
-	if stats := store.Stats(); stats != 2 {
+	if stats := store.Stats(context.Background()); stats != 2 {
 		t.Errorf("Expected 2 URLs, got %d", stats)
 	}
 }
+
+func TestInMemoryURLStore_Expiry(t *testing.T) {
+	store := NewInMemoryURLStore()
+
+	// Set a URL that has already expired
+	expired, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{
+		UserID:    "user1",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	// Set a URL that expires in the future
+	live, _, err := store.SetWithOptions(context.Background(), "https://example.org", SetOptions{
+		UserID:    "user1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	if _, err := store.Get(context.Background(), expired); err != ErrCodeExpired {
+		t.Errorf("Expected ErrCodeExpired, got %v", err)
+	}
+	if _, err := store.Get(context.Background(), live); err != nil {
+		t.Errorf("Failed to get live URL: %v", err)
+	}
+
+	// Purging removes only the expired URL
+	removed, err := store.PurgeExpired(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to purge expired URLs: %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Expected 1 purged URL, got %d", removed)
+	}
+	if _, err := store.Get(context.Background(), expired); err != ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound after purge, got %v", err)
+	}
+
+	entries, err := store.GetByUser(context.Background(), "user1")
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Code != live {
+		t.Errorf("Expected only %s in user URLs, got %v", live, entries)
+	}
+}
+
+func TestInMemoryURLStore_PurgeForgetsHistory(t *testing.T) {
+	store := NewInMemoryURLStore()
+	testPurgeForgetsHistory(t, store, store.ClickStore(), store.CheckStore())
+}
+
+// testPurgeForgetsHistory purges an expired alias that has clicks and
+// checks, then claims the alias again and expects the new link to start
+// with an empty history, and to leave none behind when deleted.
+func testPurgeForgetsHistory(t *testing.T, store URLStore, clicks ClickStore, checks CheckStore) {
+	t.Helper()
+	ctx := context.Background()
+
+	alias := fmt.Sprintf("purge%d", time.Now().UnixNano()%1e12)
+	code, _, err := store.SetWithOptions(ctx, "https://example.com", SetOptions{
+		Alias:     alias,
+		UserID:    "previous-owner",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if err := clicks.RecordClicks([]Click{{Code: code, Timestamp: time.Now(), Referrer: "https://referrer.example"}}); err != nil {
+		t.Fatalf("Failed to record click: %v", err)
+	}
+	if err := checks.RecordCheck(LinkCheck{Code: code, URL: "https://example.com", CheckedAt: time.Now(), Status: CheckOK, Health: LinkHealthy}); err != nil {
+		t.Fatalf("Failed to record check: %v", err)
+	}
+
+	if removed, err := store.PurgeExpired(ctx); err != nil || removed < 1 {
+		t.Fatalf("Expected the alias to be purged, got %d (%v)", removed, err)
+	}
+
+	code, _, err = store.SetWithOptions(ctx, "https://example.org", SetOptions{Alias: alias, UserID: "next-owner"})
+	if err != nil {
+		t.Fatalf("Failed to reuse alias: %v", err)
+	}
+	t.Cleanup(func() {
+		store.Delete(ctx, code, "next-owner")
+	})
+
+	stats, err := clicks.ClickStats(code, time.Now().AddDate(0, 0, -1), 10)
+	if err != nil {
+		t.Fatalf("Failed to get click stats: %v", err)
+	}
+	if stats.TotalClicks != 0 || len(stats.TopReferrers) != 0 {
+		t.Errorf("Expected no clicks for the new owner, got %+v", stats)
+	}
+	history, err := checks.CheckHistory(code, MaxCheckHistory)
+	if err != nil {
+		t.Fatalf("Failed to get check history: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected no checks for the new owner, got %+v", history)
+	}
+
+	// Deleting a link forgets its history too
+	if err := clicks.RecordClicks([]Click{{Code: code, Timestamp: time.Now()}}); err != nil {
+		t.Fatalf("Failed to record click: %v", err)
+	}
+	if err := checks.RecordCheck(LinkCheck{Code: code, URL: "https://example.org", CheckedAt: time.Now(), Status: CheckOK, Health: LinkHealthy}); err != nil {
+		t.Fatalf("Failed to record check: %v", err)
+	}
+	if err := store.Delete(ctx, code, "next-owner"); err != nil {
+		t.Fatalf("Failed to delete alias: %v", err)
+	}
+	if stats, err := clicks.ClickStats(code, time.Now().AddDate(0, 0, -1), 10); err != nil || stats.TotalClicks != 0 {
+		t.Errorf("Expected no clicks after delete, got %+v (%v)", stats, err)
+	}
+	if history, err := checks.CheckHistory(code, MaxCheckHistory); err != nil || len(history) != 0 {
+		t.Errorf("Expected no checks after delete, got %+v (%v)", history, err)
+	}
+}
+
+func TestInMemoryURLStore_MaxClicks(t *testing.T) {
+	store := NewInMemoryURLStore()
+
+	code, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{MaxClicks: 2})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	// Lookups do not count as visits
+	if _, err := store.Lookup(context.Background(), code); err != nil {
+		t.Fatalf("Failed to look up URL: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := store.Get(context.Background(), code); err != nil {
+			t.Errorf("Visit %d: failed to get URL: %v", i+1, err)
+		}
+	}
+
+	if _, err := store.Get(context.Background(), code); err != ErrClicksExhausted {
+		t.Errorf("Expected ErrClicksExhausted, got %v", err)
+	}
+}
+
+func TestInMemoryURLStore_UpdateDelete(t *testing.T) {
+	store := NewInMemoryURLStore()
+
+	code, _, err := store.SetWithOptions(context.Background(), "https://example.com", SetOptions{UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	other, _, err := store.SetWithOptions(context.Background(), "https://example.net", SetOptions{UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	// Only the owner may change the destination
+	if err := store.Update(context.Background(), code, "https://example.org", "intruder"); err != ErrNotOwner {
+		t.Errorf("Expected ErrNotOwner, got %v", err)
+	}
+	if err := store.Update(context.Background(), code, "https://example.org", "owner"); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if url, _ := store.Get(context.Background(), code); url != "https://example.org" {
+		t.Errorf("Expected updated URL, got %s", url)
+	}
+	if err := store.Update(context.Background(), "missing", "https://example.org", "owner"); err != ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+
+	// Only the owner may delete, and the user index follows
+	if err := store.Delete(context.Background(), code, "intruder"); err != ErrNotOwner {
+		t.Errorf("Expected ErrNotOwner, got %v", err)
+	}
+	if err := store.Delete(context.Background(), code, "owner"); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if _, err := store.Get(context.Background(), code); err != ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound after delete, got %v", err)
+	}
+
+	entries, err := store.GetByUser(context.Background(), "owner")
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Code != other {
+		t.Errorf("Expected only %s in user URLs, got %v", other, entries)
+	}
+}
@@ -0,0 +1,822 @@
+// Package storetest is a conformance suite for store.URLStore
+// implementations. A backend passes the suite by calling Run from its own
+// tests with a factory that returns a ready store:
+//
+//	func TestMyStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) store.URLStore {
+//			return newMyStore(t)
+//		})
+//	}
+//
+// The suite only creates links under fresh user IDs and aliases, so it can
+// run against a shared database that already holds data.
+package storetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+// Factory returns an empty or shared store for one subtest. It should
+// register any cleanup with t.
+type Factory func(t *testing.T) store.URLStore
+
+// Run exercises every URLStore method against stores from newStore.
+func Run(t *testing.T, newStore Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.URLStore)
+	}{
+		{"Set", testSet},
+		{"Get", testGet},
+		{"Resolve", testResolve},
+		{"Lookup", testLookup},
+		{"Alias", testAlias},
+		{"GetByUser", testGetByUser},
+		{"Update", testUpdate},
+		{"Delete", testDelete},
+		{"Expiry", testExpiry},
+		{"MaxClicks", testMaxClicks},
+		{"Stats", testStats},
+		{"ConcurrentSet", testConcurrentSet},
+		{"LastClickRace", testLastClickRace},
+		{"AliasRace", testAliasRace},
+		{"Generator", testGenerator},
+		{"Metadata", testMetadata},
+		{"Dedupe", testDedupe},
+		{"DedupeRace", testDedupeRace},
+		{"DueForCheck", testDueForCheck},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newStore(t))
+		})
+	}
+}
+
+// unique returns a random lower-case alphanumeric string with prefix, valid
+// as both a user ID and an alias under the default alias policy.
+func unique(t *testing.T, prefix string) string {
+	t.Helper()
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Failed to generate random suffix: %v", err)
+	}
+	return prefix + hex.EncodeToString(b)
+}
+
+// set creates a link owned by opts.UserID and deletes it when the test ends.
+func set(t *testing.T, s store.URLStore, url string, opts store.SetOptions) string {
+	t.Helper()
+	ctx := context.Background()
+
+	code, _, err := s.SetWithOptions(ctx, url, opts)
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Delete(ctx, code, opts.UserID)
+	})
+
+	return code
+}
+
+func testSet(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	code, err := s.Set(ctx, "https://example.com")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Delete(ctx, code, "anonymous")
+	})
+	if code == "" {
+		t.Error("Expected non-empty code")
+	}
+
+	if _, err := s.Set(ctx, ""); err != store.ErrInvalidURL {
+		t.Errorf("Set: expected ErrInvalidURL, got %v", err)
+	}
+	if _, _, err := s.SetWithOptions(ctx, "", store.SetOptions{UserID: unique(t, "user")}); err != store.ErrInvalidURL {
+		t.Errorf("SetWithOptions: expected ErrInvalidURL, got %v", err)
+	}
+
+	other := set(t, s, "https://example.com", store.SetOptions{UserID: unique(t, "user")})
+	if other == code {
+		t.Error("Expected different codes for separate links to the same URL")
+	}
+}
+
+func testGet(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: unique(t, "user")})
+
+	url, err := s.Get(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+	if url != "https://example.com" {
+		t.Errorf("Expected https://example.com, got %s", url)
+	}
+
+	if _, err := s.Get(ctx, unique(t, "missing")); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+}
+
+func testResolve(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: unique(t, "user"), MaxClicks: 2})
+
+	entry, err := s.Resolve(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to resolve URL: %v", err)
+	}
+	if entry.Code != code || entry.URL != "https://example.com" {
+		t.Errorf("Expected %s -> https://example.com, got %s -> %s", code, entry.Code, entry.URL)
+	}
+	if entry.ClicksRemaining == nil || *entry.ClicksRemaining != 1 {
+		t.Errorf("Expected the visit to leave 1 click, got %v", entry.ClicksRemaining)
+	}
+
+	if _, err := s.Resolve(ctx, unique(t, "missing")); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+}
+
+func testLookup(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+	before := time.Now().Add(-time.Second)
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: userID})
+
+	entry, err := s.Lookup(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to look up URL: %v", err)
+	}
+	if entry.Code != code || entry.URL != "https://example.com" || entry.UserID != userID {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if entry.CreatedAt.Before(before) {
+		t.Errorf("Expected a recent creation time, got %v", entry.CreatedAt)
+	}
+	if entry.ExpiresAt != nil || entry.ClicksRemaining != nil {
+		t.Errorf("Expected no expiry or click limit, got %+v", entry)
+	}
+
+	if _, err := s.Lookup(ctx, unique(t, "missing")); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+
+	// Links created without a user belong to "anonymous"
+	anonymous, err := s.Set(ctx, "https://example.org")
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Delete(ctx, anonymous, "anonymous")
+	})
+	if entry, err := s.Lookup(ctx, anonymous); err != nil || entry.UserID != "anonymous" {
+		t.Errorf("Expected an anonymous owner, got %q (%v)", entry.UserID, err)
+	}
+}
+
+func testAlias(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+	alias := unique(t, "a")
+
+	code := set(t, s, "https://example.com", store.SetOptions{Alias: alias, UserID: userID})
+	if code != alias {
+		t.Errorf("Expected code %q, got %q", alias, code)
+	}
+	if url, err := s.Get(ctx, alias); err != nil || url != "https://example.com" {
+		t.Errorf("Expected alias to resolve, got %q (%v)", url, err)
+	}
+	if entry, err := s.Lookup(ctx, alias); err != nil || !entry.Alias {
+		t.Errorf("Expected an alias entry, got %+v (%v)", entry, err)
+	}
+	generated := set(t, s, "https://example.com", store.SetOptions{UserID: userID})
+	if entry, err := s.Lookup(ctx, generated); err != nil || entry.Alias {
+		t.Errorf("Expected a generated code not to be an alias, got %+v (%v)", entry, err)
+	}
+
+	if _, _, err := s.SetWithOptions(ctx, "https://example.org", store.SetOptions{Alias: alias, UserID: userID}); err != store.ErrAliasInUse {
+		t.Errorf("Expected ErrAliasInUse, got %v", err)
+	}
+	if url, _ := s.Get(ctx, alias); url != "https://example.com" {
+		t.Errorf("Expected the original destination to be kept, got %s", url)
+	}
+}
+
+func testGetByUser(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+
+	var codes []string
+	for _, url := range []string{"https://example.com/1", "https://example.com/2", "https://example.com/3"} {
+		codes = append(codes, set(t, s, url, store.SetOptions{UserID: userID}))
+		// Keep creation times distinct on stores with coarse clocks.
+		time.Sleep(5 * time.Millisecond)
+	}
+	set(t, s, "https://example.org", store.SetOptions{UserID: unique(t, "user")})
+
+	entries, err := s.GetByUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != len(codes) {
+		t.Fatalf("Expected %d entries, got %d", len(codes), len(entries))
+	}
+
+	// Newest first
+	for i, entry := range entries {
+		want := codes[len(codes)-1-i]
+		if entry.Code != want {
+			t.Errorf("Entry %d: expected %s, got %s", i, want, entry.Code)
+		}
+		if entry.UserID != userID {
+			t.Errorf("Entry %d: expected owner %s, got %s", i, userID, entry.UserID)
+		}
+	}
+
+	entries, err = s.GetByUser(ctx, unique(t, "nobody"))
+	if err != nil {
+		t.Fatalf("Failed to get URLs of unknown user: %v", err)
+	}
+	if entries == nil || len(entries) != 0 {
+		t.Errorf("Expected an empty, non-nil slice, got %#v", entries)
+	}
+}
+
+func testUpdate(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: owner})
+
+	if err := s.Update(ctx, code, "https://example.org", unique(t, "intruder")); err != store.ErrNotOwner {
+		t.Errorf("Expected ErrNotOwner, got %v", err)
+	}
+	if err := s.Update(ctx, code, "", owner); err != store.ErrInvalidURL {
+		t.Errorf("Expected ErrInvalidURL, got %v", err)
+	}
+	if err := s.Update(ctx, unique(t, "missing"), "https://example.org", owner); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+
+	if err := s.Update(ctx, code, "https://example.org", owner); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if url, err := s.Get(ctx, code); err != nil || url != "https://example.org" {
+		t.Errorf("Expected updated URL, got %q (%v)", url, err)
+	}
+}
+
+func testDelete(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: owner})
+	kept := set(t, s, "https://example.org", store.SetOptions{UserID: owner})
+
+	if err := s.Delete(ctx, code, unique(t, "intruder")); err != store.ErrNotOwner {
+		t.Errorf("Expected ErrNotOwner, got %v", err)
+	}
+	if err := s.Delete(ctx, code, owner); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if err := s.Delete(ctx, code, owner); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound on second delete, got %v", err)
+	}
+	if _, err := s.Get(ctx, code); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound after delete, got %v", err)
+	}
+	if _, err := s.Lookup(ctx, code); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound from Lookup after delete, got %v", err)
+	}
+
+	entries, err := s.GetByUser(ctx, owner)
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Code != kept {
+		t.Errorf("Expected only %s in user URLs, got %v", kept, entries)
+	}
+}
+
+func testExpiry(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+	expired := set(t, s, "https://example.com", store.SetOptions{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	live := set(t, s, "https://example.org", store.SetOptions{
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	if _, err := s.Get(ctx, expired); err != store.ErrCodeExpired {
+		t.Errorf("Expected ErrCodeExpired, got %v", err)
+	}
+	if entry, err := s.Lookup(ctx, expired); err != nil || entry.ExpiresAt == nil {
+		t.Errorf("Expected Lookup to return the expired entry, got %+v (%v)", entry, err)
+	}
+	if _, err := s.Get(ctx, live); err != nil {
+		t.Errorf("Failed to get live URL: %v", err)
+	}
+
+	// Other data in a shared store may expire too, so only a lower bound
+	// on the count holds.
+	removed, err := s.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatalf("Failed to purge expired URLs: %v", err)
+	}
+	if removed < 1 {
+		t.Errorf("Expected at least 1 purged URL, got %d", removed)
+	}
+	if _, err := s.Lookup(ctx, expired); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound after purge, got %v", err)
+	}
+
+	entries, err := s.GetByUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Code != live {
+		t.Errorf("Expected only %s in user URLs, got %v", live, entries)
+	}
+}
+
+func testMaxClicks(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: unique(t, "user"), MaxClicks: 2})
+
+	// Lookups do not count as visits
+	entry, err := s.Lookup(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to look up URL: %v", err)
+	}
+	if entry.ClicksRemaining == nil || *entry.ClicksRemaining != 2 {
+		t.Errorf("Expected 2 clicks remaining, got %v", entry.ClicksRemaining)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Get(ctx, code); err != nil {
+			t.Errorf("Visit %d: failed to get URL: %v", i+1, err)
+		}
+	}
+	if _, err := s.Get(ctx, code); err != store.ErrClicksExhausted {
+		t.Errorf("Expected ErrClicksExhausted, got %v", err)
+	}
+
+	entry, err = s.Lookup(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to look up exhausted URL: %v", err)
+	}
+	if entry.ClicksRemaining == nil || *entry.ClicksRemaining != 0 {
+		t.Errorf("Expected 0 clicks remaining, got %v", entry.ClicksRemaining)
+	}
+
+	// An expired link with clicks left is expired, not exhausted
+	expired := set(t, s, "https://example.com", store.SetOptions{
+		UserID:    unique(t, "user"),
+		MaxClicks: 2,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if _, err := s.Get(ctx, expired); err != store.ErrCodeExpired {
+		t.Errorf("Expected ErrCodeExpired, got %v", err)
+	}
+}
+
+func testStats(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	before := s.Stats(ctx)
+
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: owner})
+	if stats := s.Stats(ctx); stats != before+1 {
+		t.Errorf("Expected %d URLs, got %d", before+1, stats)
+	}
+
+	if err := s.Delete(ctx, code, owner); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if stats := s.Stats(ctx); stats != before {
+		t.Errorf("Expected %d URLs after delete, got %d", before, stats)
+	}
+}
+
+func testConcurrentSet(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+
+	const writers = 50
+	codes := make([]string, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, _, err := s.SetWithOptions(ctx, "https://example.com", store.SetOptions{UserID: userID})
+			if err != nil {
+				t.Errorf("Failed to set URL: %v", err)
+				return
+			}
+			codes[i] = code
+		}(i)
+	}
+	wg.Wait()
+	t.Cleanup(func() {
+		for _, code := range codes {
+			s.Delete(ctx, code, userID)
+		}
+	})
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("Code %s was issued twice", code)
+		}
+		seen[code] = true
+	}
+
+	entries, err := s.GetByUser(ctx, userID)
+	if err != nil {
+		t.Fatalf("Failed to get user URLs: %v", err)
+	}
+	if len(entries) != writers {
+		t.Errorf("Expected %d user URLs, got %d", writers, len(entries))
+	}
+}
+
+// testLastClickRace fires many concurrent visits at a single-use link and
+// checks that exactly one of them is allowed through.
+func testLastClickRace(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: unique(t, "user"), MaxClicks: 1})
+
+	const visitors = 50
+	var wg sync.WaitGroup
+	var successes, exhausted int64
+	for i := 0; i < visitors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Get(ctx, code)
+			switch err {
+			case nil:
+				atomic.AddInt64(&successes, 1)
+			case store.ErrClicksExhausted:
+				atomic.AddInt64(&exhausted, 1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Errorf("Expected exactly 1 successful visit, got %d", successes)
+	}
+	if exhausted != visitors-1 {
+		t.Errorf("Expected %d exhausted visits, got %d", visitors-1, exhausted)
+	}
+}
+
+// testAliasRace has many clients reserve the same alias at once and checks
+// that exactly one wins while the rest see ErrAliasInUse.
+func testAliasRace(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+	alias := unique(t, "race")
+	t.Cleanup(func() {
+		s.Delete(ctx, alias, userID)
+	})
+
+	const clients = 50
+	var wg sync.WaitGroup
+	var successes, conflicts int64
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := s.SetWithOptions(ctx, "https://example.com", store.SetOptions{Alias: alias, UserID: userID})
+			switch err {
+			case nil:
+				atomic.AddInt64(&successes, 1)
+			case store.ErrAliasInUse:
+				atomic.AddInt64(&conflicts, 1)
+			default:
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Errorf("Expected exactly 1 reservation, got %d", successes)
+	}
+	if conflicts != clients-1 {
+		t.Errorf("Expected %d conflicts, got %d", clients-1, conflicts)
+	}
+}
+
+// fixedGenerator returns its codes in order, then repeats the last one.
+type fixedGenerator struct {
+	mutex sync.Mutex
+	codes []string
+}
+
+func (g *fixedGenerator) Generate(_ context.Context) (string, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	code := g.codes[0]
+	if len(g.codes) > 1 {
+		g.codes = g.codes[1:]
+	}
+	return code, nil
+}
+
+func testGenerator(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+	taken := set(t, s, "https://example.com", store.SetOptions{UserID: userID})
+	fresh := unique(t, "gen")
+
+	// A colliding code is retried with the next one
+	code := set(t, s, "https://example.org", store.SetOptions{
+		UserID:    userID,
+		Generator: &fixedGenerator{codes: []string{taken, fresh}},
+	})
+	if code != fresh {
+		t.Errorf("Expected code %q after a collision, got %q", fresh, code)
+	}
+
+	// A generator that only collides gives up
+	_, _, err := s.SetWithOptions(ctx, "https://example.net", store.SetOptions{
+		UserID:    userID,
+		Generator: &fixedGenerator{codes: []string{taken}},
+	})
+	if err != store.ErrCodeSpaceExhausted {
+		t.Errorf("Expected ErrCodeSpaceExhausted, got %v", err)
+	}
+}
+
+func testMetadata(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	code := set(t, s, "https://example.com", store.SetOptions{UserID: owner})
+
+	entry, err := s.Lookup(ctx, code)
+	if err != nil {
+		t.Fatalf("Failed to look up URL: %v", err)
+	}
+	if entry.Metadata != nil {
+		t.Errorf("Expected no metadata before a check, got %+v", entry.Metadata)
+	}
+
+	checkedAt := time.Now().Truncate(time.Millisecond)
+	nextCheckAt := checkedAt.Add(time.Hour)
+	meta := store.LinkMetadata{
+		CheckedAt:   checkedAt,
+		Status:      store.CheckOK,
+		StatusCode:  200,
+		ContentType: "text/html; charset=utf-8",
+		Title:       "Example Domain",
+		Description: "For use in illustrative examples.",
+		ImageURL:    "https://example.com/preview.png",
+		FaviconURL:  "https://example.com/favicon.ico",
+		Health:      store.LinkHealthy,
+		HealthSince: &checkedAt,
+		NextCheckAt: &nextCheckAt,
+	}
+	if err := s.SetMetadata(ctx, code, "https://example.com", meta); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+
+	entries, err := s.GetByUser(ctx, owner)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 user URL, got %v (%v)", entries, err)
+	}
+	got := entries[0].Metadata
+	if got == nil || !got.CheckedAt.Equal(meta.CheckedAt) || got.Status != meta.Status ||
+		got.StatusCode != meta.StatusCode || got.ContentType != meta.ContentType || got.Title != meta.Title ||
+		got.Description != meta.Description || got.ImageURL != meta.ImageURL || got.FaviconURL != meta.FaviconURL {
+		t.Errorf("Expected metadata %+v, got %+v", meta, got)
+	}
+	if got != nil && (got.Health != meta.Health || got.Failures != meta.Failures ||
+		got.HealthSince == nil || !got.HealthSince.Equal(checkedAt) ||
+		got.NextCheckAt == nil || !got.NextCheckAt.Equal(nextCheckAt)) {
+		t.Errorf("Expected health %+v, got %+v", meta, got)
+	}
+	if entry, err := s.Lookup(ctx, code); err != nil || entry.Metadata == nil || entry.Metadata.Title != meta.Title {
+		t.Errorf("Expected Lookup to return the metadata, got %+v (%v)", entry.Metadata, err)
+	}
+
+	// A result for a destination the link no longer has is ignored
+	if err := s.Update(ctx, code, "https://example.org", owner); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if entry, err := s.Lookup(ctx, code); err != nil || entry.Metadata != nil {
+		t.Errorf("Expected update to clear metadata, got %+v (%v)", entry.Metadata, err)
+	}
+	failed := store.LinkMetadata{CheckedAt: time.Now(), Status: store.CheckFailed, Error: "connection refused"}
+	if err := s.SetMetadata(ctx, code, "https://example.com", failed); err != nil {
+		t.Fatalf("Expected a stale result to be ignored, got %v", err)
+	}
+	if entry, err := s.Lookup(ctx, code); err != nil || entry.Metadata != nil {
+		t.Errorf("Expected no metadata from a stale result, got %+v (%v)", entry.Metadata, err)
+	}
+
+	if err := s.SetMetadata(ctx, code, "https://example.org", failed); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	if entry, err := s.Lookup(ctx, code); err != nil || entry.Metadata == nil || entry.Metadata.Error != failed.Error {
+		t.Errorf("Expected failed metadata, got %+v (%v)", entry.Metadata, err)
+	}
+
+	if err := s.SetMetadata(ctx, unique(t, "missing"), "https://example.com", meta); err != store.ErrCodeNotFound {
+		t.Errorf("Expected ErrCodeNotFound, got %v", err)
+	}
+}
+
+func testDedupe(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	code := set(t, s, "https://Example.com:443/page#top", store.SetOptions{UserID: owner, Dedupe: true})
+
+	again, existing, err := s.SetWithOptions(ctx, "https://example.com/page", store.SetOptions{UserID: owner, Dedupe: true})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	if again != code || !existing {
+		t.Errorf("Expected existing code %q, got %q (existing %v)", code, again, existing)
+	}
+
+	// Other users, and requests without dedupe, get links of their own
+	if other := set(t, s, "https://example.com/page", store.SetOptions{UserID: unique(t, "user"), Dedupe: true}); other == code {
+		t.Error("Expected another user to get a different code")
+	}
+	if plain := set(t, s, "https://example.com/page", store.SetOptions{UserID: owner}); plain == code {
+		t.Error("Expected a new code without dedupe")
+	}
+
+	// So do links with a click limit
+	if limited := set(t, s, "https://example.com/page", store.SetOptions{UserID: owner, MaxClicks: 5, Dedupe: true}); limited == code {
+		t.Error("Expected a new code for a click-limited link")
+	}
+
+	// Once the link points elsewhere, the old URL gets a new link
+	if err := s.Update(ctx, code, "https://example.org", owner); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	fresh, existing, err := s.SetWithOptions(ctx, "https://example.com/page", store.SetOptions{UserID: owner, Dedupe: true})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Delete(ctx, fresh, owner)
+	})
+	if fresh == code || existing {
+		t.Errorf("Expected a new code after update, got %q (existing %v)", fresh, existing)
+	}
+
+	// And after deletion
+	if err := s.Delete(ctx, fresh, owner); err != nil {
+		t.Fatalf("Failed to delete URL: %v", err)
+	}
+	if _, existing, err := s.SetWithOptions(ctx, "https://example.com/page", store.SetOptions{UserID: owner, Dedupe: true}); err != nil || existing {
+		t.Errorf("Expected a new link after delete, got existing %v (%v)", existing, err)
+	}
+}
+
+// testDedupeRace has many clients shorten the same URL for one user at once
+// and checks that they all end up with the same code.
+func testDedupeRace(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	userID := unique(t, "user")
+
+	const clients = 50
+	var wg sync.WaitGroup
+	codes := make([]string, clients)
+	var created int64
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			code, existing, err := s.SetWithOptions(ctx, "https://example.com", store.SetOptions{UserID: userID, Dedupe: true})
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			if !existing {
+				atomic.AddInt64(&created, 1)
+			}
+			codes[i] = code
+		}(i)
+	}
+	wg.Wait()
+
+	t.Cleanup(func() {
+		s.Delete(ctx, codes[0], userID)
+	})
+	if created != 1 {
+		t.Errorf("Expected exactly 1 new link, got %d", created)
+	}
+	for _, code := range codes {
+		if code != codes[0] {
+			t.Fatalf("Expected every client to get %q, got %q", codes[0], code)
+		}
+	}
+}
+
+func testDueForCheck(t *testing.T, s store.URLStore) {
+	ctx := context.Background()
+
+	owner := unique(t, "user")
+	unchecked := set(t, s, "https://example.com/unchecked", store.SetOptions{UserID: owner})
+	overdue := set(t, s, "https://example.com/overdue", store.SetOptions{UserID: owner})
+	later := set(t, s, "https://example.com/later", store.SetOptions{UserID: owner})
+	exhausted := set(t, s, "https://example.com/exhausted", store.SetOptions{UserID: owner, MaxClicks: 1})
+
+	// Far enough in the past to be the most overdue link in a shared store
+	past := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+	future := time.Now().Add(time.Hour)
+	schedule := func(code, url string, next time.Time) {
+		t.Helper()
+		meta := store.LinkMetadata{CheckedAt: time.Now(), Status: store.CheckOK, NextCheckAt: &next}
+		if err := s.SetMetadata(ctx, code, url, meta); err != nil {
+			t.Fatalf("Failed to set metadata: %v", err)
+		}
+	}
+	schedule(overdue, "https://example.com/overdue", past)
+	schedule(later, "https://example.com/later", future)
+	schedule(exhausted, "https://example.com/exhausted", past)
+	if _, err := s.Get(ctx, exhausted); err != nil {
+		t.Fatalf("Failed to get URL: %v", err)
+	}
+
+	due := func(limit int) map[string]bool {
+		t.Helper()
+		entries, err := s.DueForCheck(ctx, time.Now(), limit)
+		if err != nil {
+			t.Fatalf("Failed to list links due for a check: %v", err)
+		}
+		codes := make(map[string]bool)
+		for _, entry := range entries {
+			codes[entry.Code] = true
+		}
+		return codes
+	}
+
+	if codes := due(1); !codes[overdue] {
+		t.Errorf("Expected the most overdue link first, got %v", codes)
+	}
+
+	codes := due(10000)
+	if !codes[unchecked] {
+		t.Error("Expected a link that was never checked to be due")
+	}
+	if codes[later] {
+		t.Error("Expected a link scheduled in the future not to be due")
+	}
+	if codes[exhausted] {
+		t.Error("Expected a link without clicks remaining not to be due")
+	}
+
+	// A new destination needs checking straight away
+	if err := s.Update(ctx, later, "https://example.org", owner); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	if codes := due(10000); !codes[later] {
+		t.Error("Expected an updated link to be due")
+	}
+}
@@ -0,0 +1,244 @@
+// Package urlnorm validates user-submitted destinations and rewrites them in
+// a canonical form, so that only well-formed web URLs are stored and
+// equivalent spellings of a URL compare equal.
+package urlnorm
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Reason classifies why a URL was rejected.
+type Reason string
+
+const (
+	ReasonEmpty            Reason = "empty"
+	ReasonTooLong          Reason = "too_long"
+	ReasonMalformed        Reason = "malformed"
+	ReasonMissingScheme    Reason = "missing_scheme"
+	ReasonSchemeNotAllowed Reason = "scheme_not_allowed"
+	ReasonMissingHost      Reason = "missing_host"
+	ReasonInvalidHost      Reason = "invalid_host"
+	ReasonInvalidPort      Reason = "invalid_port"
+	ReasonUserinfo         Reason = "userinfo"
+)
+
+// Error reports a rejected URL. Reason is stable and meant for programs;
+// Message is meant for people.
+type Error struct {
+	Reason  Reason
+	Message string
+}
+
+func (e *Error) Error() string {
+	return "invalid URL: " + e.Message
+}
+
+func reject(reason Reason, format string, args ...any) *Error {
+	return &Error{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// Policy decides which URLs are accepted.
+type Policy struct {
+	// Schemes lists the accepted schemes, in lower case.
+	Schemes []string
+	// MaxLength bounds the length of both the submitted and the canonical
+	// URL, in bytes.
+	MaxLength int
+}
+
+// DefaultPolicy accepts http and https URLs of up to 2048 bytes, the
+// longest that every mainstream browser handles.
+var DefaultPolicy = Policy{
+	Schemes:   []string{"http", "https"},
+	MaxLength: 2048,
+}
+
+// lookup maps host names as browsers do. It allows underscores, which are
+// not valid in host names but are common in real subdomains.
+var lookup = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true), idna.StrictDomainName(false))
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize checks raw against the policy and returns its canonical
+// form: scheme and host in lower case, internationalized host names in
+// punycode, default ports dropped, an empty path written as "/" and
+// percent-encoding normalized. Any error is an *Error.
+func (p Policy) Canonicalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", reject(ReasonEmpty, "URL is required")
+	}
+	if len(raw) > p.MaxLength {
+		return "", reject(ReasonTooLong, "URL is longer than %d bytes", p.MaxLength)
+	}
+	for _, r := range raw {
+		if r < 0x20 || r == 0x7f || r == ' ' {
+			return "", reject(ReasonMalformed, "URL contains whitespace or control characters")
+		}
+	}
+
+	u, err := url.Parse(escapeStrayPercents(raw))
+	if err != nil {
+		return "", reject(ReasonMalformed, "URL could not be parsed")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme == "" {
+		return "", reject(ReasonMissingScheme, "URL must start with a scheme such as https://")
+	}
+	if !p.allowsScheme(scheme) {
+		return "", reject(ReasonSchemeNotAllowed, "scheme %q is not allowed", scheme)
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", reject(ReasonMissingHost, "URL has no host")
+	}
+
+	// "https://www.bank.com@evil.example/" takes the visitor to
+	// evil.example; credentials have no legitimate use in a short link.
+	if u.User != nil {
+		return "", reject(ReasonUserinfo, "URL must not contain a user name or password")
+	}
+
+	host, err := canonicalHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+	if port := u.Port(); port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", reject(ReasonInvalidPort, "port %q is out of range", port)
+		}
+		if port = strconv.Itoa(n); port != defaultPorts[scheme] {
+			host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	b.WriteString(host)
+	if path := normalizeEscapes(u.EscapedPath()); path != "" {
+		b.WriteString(path)
+	} else {
+		b.WriteByte('/')
+	}
+	if u.ForceQuery || u.RawQuery != "" {
+		b.WriteByte('?')
+		b.WriteString(normalizeEscapes(u.RawQuery))
+	}
+	if u.Fragment != "" {
+		b.WriteByte('#')
+		b.WriteString(normalizeEscapes(u.EscapedFragment()))
+	}
+
+	canonical := b.String()
+	if len(canonical) > p.MaxLength {
+		return "", reject(ReasonTooLong, "URL is longer than %d bytes", p.MaxLength)
+	}
+
+	return canonical, nil
+}
+
+func (p Policy) allowsScheme(scheme string) bool {
+	for _, allowed := range p.Schemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHost lower-cases host and converts internationalized names to
+// punycode, rejecting names that are not valid for DNS lookups. IPv6
+// literals are returned in brackets.
+func canonicalHost(host string) (string, error) {
+	if host == "" {
+		return "", reject(ReasonMissingHost, "URL has no host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() == nil {
+			return "[" + ip.String() + "]", nil
+		}
+		return ip.String(), nil
+	}
+
+	ascii, err := lookup.ToASCII(strings.TrimSuffix(host, "."))
+	if err != nil || ascii == "" {
+		return "", reject(ReasonInvalidHost, "host %q is not a valid domain name", host)
+	}
+
+	return ascii, nil
+}
+
+// escapeStrayPercents escapes "%" signs that do not start an escape, such as
+// the one in "50%off", which browsers accept but url.Parse does not.
+func escapeStrayPercents(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	for i := 0; i < len(s); i++ {
+		b.WriteByte(s[i])
+		if s[i] == '%' && !(i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2])) {
+			b.WriteString("25")
+		}
+	}
+	return b.String()
+}
+
+// normalizeEscapes rewrites an escaped URL component so that equivalent
+// encodings compare equal: escapes of unreserved characters are decoded,
+// other escapes use upper-case hex and bytes that may not appear literally
+// in a URL are encoded.
+func normalizeEscapes(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", decoded)
+			}
+			i += 2
+		case c == '%' || c >= 0x80 || strings.IndexByte(` "<>\^`+"`{|}", c) >= 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
@@ -0,0 +1,123 @@
+package workers
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+// ClickWriter buffers clicks in memory and writes them to a ClickStore in
+// batches, so recording a click never blocks a redirect on the database.
+type ClickWriter struct {
+	store         store.ClickStore
+	batchSize     int
+	flushInterval time.Duration
+	clicks        chan store.Click
+	dropped       int64
+	wg            sync.WaitGroup
+	stopOnce      sync.Once
+	// stopped is set by Stop under mutex. Record sends while holding the
+	// read lock, so no click can arrive after run's final drain.
+	mutex   sync.RWMutex
+	stopped bool
+	done    chan struct{}
+}
+
+func NewClickWriter(clickStore store.ClickStore, bufferSize, batchSize int, flushInterval time.Duration) *ClickWriter {
+	writer := &ClickWriter{
+		store:         clickStore,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		clicks:        make(chan store.Click, bufferSize),
+		done:          make(chan struct{}),
+	}
+
+	writer.wg.Add(1)
+	go writer.run()
+
+	return writer
+}
+
+func (w *ClickWriter) run() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]store.Click, 0, w.batchSize)
+	for {
+		select {
+		case click := <-w.clicks:
+			batch = append(batch, click)
+			if len(batch) >= w.batchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			w.flush(batch)
+			batch = batch[:0]
+		case <-w.done:
+			for {
+				select {
+				case click := <-w.clicks:
+					batch = append(batch, click)
+				default:
+					w.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *ClickWriter) flush(batch []store.Click) {
+	if len(batch) == 0 {
+		return
+	}
+
+	if err := w.store.RecordClicks(batch); err != nil {
+		log.Printf("Error recording %d clicks: %v", len(batch), err)
+	}
+}
+
+// Record queues a click for writing. It never blocks: when the buffer is
+// full, or the writer has been stopped, the click is dropped and false is
+// returned.
+func (w *ClickWriter) Record(click store.Click) bool {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+
+	if w.stopped {
+		return false
+	}
+
+	select {
+	case w.clicks <- click:
+		return true
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+		return false
+	}
+}
+
+// Dropped returns the number of clicks discarded because the buffer was full.
+func (w *ClickWriter) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+// Stop flushes any buffered clicks and waits for the writer to exit.
+// Clicks recorded afterwards, by redirects still running when shutdown
+// gave up on them, are dropped.
+func (w *ClickWriter) Stop() {
+	w.stopOnce.Do(func() {
+		w.mutex.Lock()
+		w.stopped = true
+		w.mutex.Unlock()
+
+		close(w.done)
+		w.wg.Wait()
+	})
+}
@@ -0,0 +1,29 @@
+package workers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+func TestClickWriter_Stop(t *testing.T) {
+	clicks := store.NewInMemoryClickStore()
+	writer := NewClickWriter(clicks, 16, 100, time.Hour)
+
+	if !writer.Record(store.Click{Code: "abc", Timestamp: time.Now()}) {
+		t.Fatal("Expected the click to be queued")
+	}
+	writer.Stop()
+
+	// Buffered clicks are flushed on Stop
+	if stats, err := clicks.ClickStats("abc", time.Now(), 10); err != nil || stats.TotalClicks != 1 {
+		t.Errorf("Expected 1 flushed click, got %d (%v)", stats.TotalClicks, err)
+	}
+
+	// A redirect still running after shutdown must not panic
+	if writer.Record(store.Click{Code: "abc", Timestamp: time.Now()}) {
+		t.Error("Expected a click recorded after Stop to be dropped")
+	}
+	writer.Stop()
+}
@@ -0,0 +1,175 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// BlockedError reports a request the URL processor refused to make because
+// its destination resolved to an internal address.
+type BlockedError struct {
+	Host   string
+	IP     net.IP
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	if e.Host != "" && e.Host != e.IP.String() {
+		return fmt.Sprintf("blocked request to %s (%s): %s address", e.Host, e.IP, e.Reason)
+	}
+	return fmt.Sprintf("blocked request to %s: %s address", e.IP, e.Reason)
+}
+
+// blockedNetworks are checked before the stdlib predicates, so metadata
+// endpoints are reported as such, and cover ranges those predicates miss.
+var blockedNetworks = []struct {
+	network *net.IPNet
+	reason  string
+}{
+	{mustCIDR("169.254.169.254/32"), "cloud metadata"},
+	{mustCIDR("fd00:ec2::254/128"), "cloud metadata"},
+	{mustCIDR("0.0.0.0/8"), "unspecified"},
+	{mustCIDR("100.64.0.0/10"), "shared address space"},
+	{mustCIDR("192.0.0.0/24"), "reserved"},
+	{mustCIDR("198.18.0.0/15"), "benchmarking"},
+	{mustCIDR("240.0.0.0/4"), "reserved"},
+	{mustCIDR("64:ff9b::/96"), "NAT64"},
+	{mustCIDR("64:ff9b:1::/48"), "NAT64"},
+}
+
+func mustCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// AllowedNetworks are internal ranges the URL processor may reach anyway,
+// such as a staging host on the private network.
+type AllowedNetworks []*net.IPNet
+
+// ParseAllowedNetworks parses a comma-separated list of CIDRs or bare IPs.
+func ParseAllowedNetworks(list string) (AllowedNetworks, error) {
+	var networks AllowedNetworks
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		cidr := entry
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed network %q: %w", entry, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (n AllowedNetworks) contains(ip net.IP) bool {
+	for _, network := range n {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIP returns a *BlockedError if ip is loopback, private, link-local,
+// multicast, a cloud metadata endpoint or otherwise not a public unicast
+// address, unless it is in allow.
+func checkIP(ip net.IP, allow AllowedNetworks) error {
+	if allow.contains(ip) {
+		return nil
+	}
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	var reason string
+	for _, blocked := range blockedNetworks {
+		if blocked.network.Contains(ip) {
+			reason = blocked.reason
+			break
+		}
+	}
+	if reason == "" {
+		switch {
+		case ip.IsLoopback():
+			reason = "loopback"
+		case ip.IsPrivate():
+			reason = "private"
+		case ip.IsLinkLocalUnicast():
+			reason = "link-local"
+		case ip.IsMulticast():
+			reason = "multicast"
+		case ip.IsUnspecified():
+			reason = "unspecified"
+		default:
+			return nil
+		}
+	}
+
+	return &BlockedError{IP: ip, Reason: reason}
+}
+
+// guardedDial returns a DialContext function whose Control hook refuses
+// connections to internal addresses. The hook sees the address actually
+// being connected to, after DNS resolution, so a host name that resolves,
+// or later rebinds, to an internal address is caught too.
+func guardedDial(dialer *net.Dialer, allow AllowedNetworks) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer.Control = func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("unexpected dial address %q", address)
+		}
+		return checkIP(ip, allow)
+	}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, address)
+		var blocked *BlockedError
+		if errors.As(err, &blocked) {
+			blocked.Host, _, _ = net.SplitHostPort(address)
+		}
+		return conn, err
+	}
+}
+
+// maxRedirects matches the limit of http.Client's default policy.
+const maxRedirects = 10
+
+// checkRedirect vets every redirect hop before it is followed: only http
+// and https are allowed, and literal internal addresses are refused before
+// dialing. Host names are checked by the dialer once they are resolved.
+func checkRedirect(allow AllowedNetworks) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("refusing redirect to %s URL", req.URL.Scheme)
+		}
+		if ip := net.ParseIP(req.URL.Hostname()); ip != nil {
+			return checkIP(ip, allow)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,117 @@
+package workers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckIP(t *testing.T) {
+	tests := []struct {
+		ip     string
+		reason string
+	}{
+		{"93.184.216.34", ""},
+		{"2606:2800:220:1:248:1893:25c8:1946", ""},
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"10.1.2.3", "private"},
+		{"172.16.0.1", "private"},
+		{"192.168.1.1", "private"},
+		{"fd12::1", "private"},
+		{"169.254.169.254", "cloud metadata"},
+		{"::ffff:169.254.169.254", "cloud metadata"},
+		{"fd00:ec2::254", "cloud metadata"},
+		{"169.254.1.1", "link-local"},
+		{"fe80::1", "link-local"},
+		{"0.0.0.0", "unspecified"},
+		{"::", "unspecified"},
+		{"100.100.100.200", "shared address space"},
+		{"224.0.0.1", "multicast"},
+		{"255.255.255.255", "reserved"},
+		{"64:ff9b::a9fe:a9fe", "NAT64"},
+	}
+
+	for _, tt := range tests {
+		err := checkIP(net.ParseIP(tt.ip), nil)
+		if tt.reason == "" {
+			if err != nil {
+				t.Errorf("checkIP(%s): expected allowed, got %v", tt.ip, err)
+			}
+			continue
+		}
+
+		var blocked *BlockedError
+		if !errors.As(err, &blocked) {
+			t.Errorf("checkIP(%s): expected *BlockedError, got %v", tt.ip, err)
+			continue
+		}
+		if blocked.Reason != tt.reason {
+			t.Errorf("checkIP(%s): expected reason %q, got %q", tt.ip, tt.reason, blocked.Reason)
+		}
+	}
+}
+
+func TestCheckIP_Allowed(t *testing.T) {
+	allow, err := ParseAllowedNetworks("10.0.0.0/8, 192.168.1.5")
+	if err != nil {
+		t.Fatalf("Failed to parse allowed networks: %v", err)
+	}
+
+	for _, ip := range []string{"10.1.2.3", "192.168.1.5"} {
+		if err := checkIP(net.ParseIP(ip), allow); err != nil {
+			t.Errorf("checkIP(%s): expected allowed, got %v", ip, err)
+		}
+	}
+	if err := checkIP(net.ParseIP("192.168.1.6"), allow); err == nil {
+		t.Error("Expected 192.168.1.6 to stay blocked")
+	}
+
+	if _, err := ParseAllowedNetworks("not-a-network"); err == nil {
+		t.Error("Expected an error for an invalid network")
+	}
+}
+
+func TestURLProcessor_BlocksInternalAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metadata" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// The test server listens on loopback, which is refused by default
+	processor := NewURLProcessor(1)
+	defer processor.Stop()
+
+	result := processor.processURL(server.URL)
+	if result.Outcome != OutcomeBlocked {
+		t.Fatalf("Expected a blocked result, got %s (%v)", result.Outcome, result.Error)
+	}
+	var blocked *BlockedError
+	if !errors.As(result.Error, &blocked) || blocked.Reason != "loopback" {
+		t.Errorf("Expected a loopback BlockedError, got %v", result.Error)
+	}
+
+	// Allowing loopback lets the request through, but not a redirect
+	// from it to the metadata endpoint
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor = NewURLProcessorWithConfig(URLProcessorConfig{Workers: 1, AllowedNetworks: allow})
+	defer processor.Stop()
+
+	if result := processor.processURL(server.URL); result.Outcome != OutcomeOK || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected an allowed request to succeed, got %s %d (%v)", result.Outcome, result.StatusCode, result.Error)
+	}
+
+	result = processor.processURL(server.URL + "/metadata")
+	if result.Outcome != OutcomeBlocked {
+		t.Fatalf("Expected the redirect to be blocked, got %s (%v)", result.Outcome, result.Error)
+	}
+	if !errors.As(result.Error, &blocked) || blocked.Reason != "cloud metadata" {
+		t.Errorf("Expected a metadata BlockedError, got %v", result.Error)
+	}
+}
@@ -0,0 +1,291 @@
+package workers
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+// URLQueue accepts links whose destination should be checked.
+// *URLProcessor implements it.
+type URLQueue interface {
+	// Offer queues a check if there is room and reports whether it did.
+	Offer(code, urlString string) bool
+}
+
+// HealthSchedulerConfig configures NewHealthScheduler.
+type HealthSchedulerConfig struct {
+	// Interval is how often the store is polled for links due for a check.
+	// Zero disables rechecks; results are still recorded.
+	Interval time.Duration
+	// BatchSize bounds how many links one poll queues.
+	BatchSize int
+	// MinInterval and MaxInterval bound the time between checks of a link.
+	// Healthy links are rechecked sooner while they are young, failing
+	// links back off exponentially from MinInterval.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	// BrokenAfter is how many consecutive failed checks mark a link broken.
+	BrokenAfter int
+}
+
+var DefaultHealthSchedulerConfig = HealthSchedulerConfig{
+	Interval:    time.Minute,
+	BatchSize:   100,
+	MinInterval: time.Hour,
+	MaxInterval: 7 * 24 * time.Hour,
+	BrokenAfter: 2,
+}
+
+const (
+	// newLinkGrace leaves a link that has never been checked to the check
+	// queued when it was created, rather than queueing a second one.
+	newLinkGrace = time.Minute
+	// pendingTimeout is how long a queued check may go without a result
+	// before the link is queued again.
+	pendingTimeout = 10 * time.Minute
+)
+
+// HealthScheduler keeps link health up to date. It periodically queues the
+// links the store reports as due, and Record turns each URL processor
+// result into the link's health, check history and next check time.
+type HealthScheduler struct {
+	store     store.URLStore
+	checks    store.CheckStore
+	queue     URLQueue
+	config    HealthSchedulerConfig
+	pending   map[string]time.Time
+	mutex     sync.Mutex
+	broken    atomic.Int64
+	recovered atomic.Int64
+	wg        sync.WaitGroup
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// NewHealthScheduler starts polling urlStore for links due for a check and
+// queueing them on queue. checks may be nil to keep no history.
+func NewHealthScheduler(urlStore store.URLStore, checks store.CheckStore, queue URLQueue, config HealthSchedulerConfig) *HealthScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	scheduler := &HealthScheduler{
+		store:   urlStore,
+		checks:  checks,
+		queue:   queue,
+		config:  config,
+		pending: make(map[string]time.Time),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+
+	if config.Interval > 0 {
+		scheduler.wg.Add(1)
+		go scheduler.run()
+	}
+
+	return scheduler
+}
+
+func (s *HealthScheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.poll()
+		}
+	}
+}
+
+// poll queues the links that are due for a check and not already queued.
+// It stops at the first link the queue has no room for, leaving the rest
+// due for the next poll, so rechecks never crowd out new links.
+func (s *HealthScheduler) poll() {
+	now := time.Now()
+	entries, err := s.store.DueForCheck(s.ctx, now, s.config.BatchSize)
+	if err != nil {
+		log.Printf("Error listing links due for a health check: %v", err)
+		return
+	}
+
+	queued := 0
+	for _, entry := range entries {
+		if entry.Metadata == nil && now.Sub(entry.CreatedAt) < newLinkGrace {
+			continue
+		}
+		if !s.markPending(entry.Code, now) {
+			continue
+		}
+		if !s.queue.Offer(entry.Code, entry.URL) {
+			s.mutex.Lock()
+			delete(s.pending, entry.Code)
+			s.mutex.Unlock()
+			break
+		}
+		queued++
+	}
+	if queued > 0 {
+		log.Printf("Queued %d links for a health check", queued)
+	}
+}
+
+func (s *HealthScheduler) markPending(code string, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if queuedAt, ok := s.pending[code]; ok && now.Sub(queuedAt) < pendingTimeout {
+		return false
+	}
+	s.pending[code] = now
+	return true
+}
+
+// Record saves a URL processor result as the link's metadata, together
+// with its health, when it is next due, and an entry in its check history.
+// Results for a destination the link no longer has are ignored.
+func (s *HealthScheduler) Record(ctx context.Context, result URLProcessResult) error {
+	s.mutex.Lock()
+	delete(s.pending, result.Code)
+	s.mutex.Unlock()
+
+	entry, err := s.store.Lookup(ctx, result.Code)
+	if err != nil {
+		return err
+	}
+	if entry.URL != result.URL {
+		return nil
+	}
+
+	meta := result.Metadata()
+	s.assess(entry, &meta)
+	if err := s.store.SetMetadata(ctx, result.Code, result.URL, meta); err != nil {
+		return err
+	}
+
+	if s.checks == nil {
+		return nil
+	}
+	return s.checks.RecordCheck(store.LinkCheck{
+		Code:       result.Code,
+		URL:        result.URL,
+		CheckedAt:  meta.CheckedAt,
+		Status:     meta.Status,
+		StatusCode: meta.StatusCode,
+		Error:      meta.Error,
+		Health:     meta.Health,
+	})
+}
+
+// assess fills in the health fields of meta, the latest check of entry,
+// from the link's previous metadata.
+func (s *HealthScheduler) assess(entry store.URLEntry, meta *store.LinkMetadata) {
+	previous := entry.Metadata
+	if previous != nil && previous.Health != "" {
+		meta.Health = previous.Health
+		meta.HealthSince = previous.HealthSince
+		meta.Failures = previous.Failures
+	}
+
+	if failedCheck(*meta) {
+		meta.Failures++
+	} else {
+		meta.Failures = 0
+	}
+
+	health := meta.Health
+	switch {
+	case meta.Failures == 0:
+		health = store.LinkHealthy
+	case meta.Failures >= s.config.BrokenAfter:
+		health = store.LinkBroken
+	case health == "":
+		// Too few failures to judge a link that has no health yet.
+		health = store.LinkHealthy
+	}
+
+	if health != meta.Health {
+		if meta.Health != "" {
+			s.transition(entry, health, meta)
+		}
+		meta.Health = health
+		checkedAt := meta.CheckedAt
+		meta.HealthSince = &checkedAt
+	}
+
+	next := meta.CheckedAt.Add(s.nextInterval(entry, meta.Failures, meta.CheckedAt))
+	meta.NextCheckAt = &next
+}
+
+func (s *HealthScheduler) transition(entry store.URLEntry, health string, meta *store.LinkMetadata) {
+	if health == store.LinkBroken {
+		s.broken.Add(1)
+		log.Printf("Link %s is broken after %d failed checks of %s: %s", entry.Code, meta.Failures, entry.URL, describeCheck(*meta))
+		return
+	}
+	s.recovered.Add(1)
+	log.Printf("Link %s is healthy again: %s answered %d", entry.Code, entry.URL, meta.StatusCode)
+}
+
+func describeCheck(meta store.LinkMetadata) string {
+	if meta.Error != "" {
+		return meta.Error
+	}
+	return http.StatusText(meta.StatusCode)
+}
+
+// nextInterval returns how long to wait before checking entry again. A
+// healthy link is rechecked after a quarter of its age, so new links are
+// watched closely; a failing one backs off exponentially. Both are bounded
+// by the configured intervals and get up to 10% jitter, so links created
+// together are not always checked together.
+func (s *HealthScheduler) nextInterval(entry store.URLEntry, failures int, now time.Time) time.Duration {
+	interval := now.Sub(entry.CreatedAt) / 4
+	if failures > 0 {
+		interval = s.config.MinInterval
+		for i := 1; i < failures && interval < s.config.MaxInterval; i++ {
+			interval *= 2
+		}
+	}
+
+	if interval < s.config.MinInterval {
+		interval = s.config.MinInterval
+	}
+	if interval > s.config.MaxInterval {
+		interval = s.config.MaxInterval
+	}
+
+	return interval + time.Duration(rand.Int63n(int64(interval)/10+1))
+}
+
+// failedCheck reports whether a check counts against a link's health: the
+// destination could not be reached, was blocked, is gone, or is failing.
+// Other client errors, such as 403 and 429, usually come from bot defences
+// in front of a page that works for people, so they do not count.
+func failedCheck(meta store.LinkMetadata) bool {
+	if meta.Status != store.CheckOK {
+		return true
+	}
+	return meta.StatusCode == http.StatusNotFound || meta.StatusCode == http.StatusGone || meta.StatusCode >= 500
+}
+
+// Transitions returns how many times links have become broken and how many
+// times they have recovered since the scheduler started.
+func (s *HealthScheduler) Transitions() (broken, recovered int64) {
+	return s.broken.Load(), s.recovered.Load()
+}
+
+func (s *HealthScheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
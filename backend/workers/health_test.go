@@ -0,0 +1,181 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+type recordingQueue struct {
+	jobs []URLJob
+	full bool
+}
+
+func (q *recordingQueue) Offer(code, urlString string) bool {
+	if q.full {
+		return false
+	}
+	q.jobs = append(q.jobs, URLJob{Code: code, URL: urlString})
+	return true
+}
+
+func TestHealthScheduler_Record(t *testing.T) {
+	ctx := context.Background()
+	urlStore := store.NewInMemoryURLStore()
+	checks := store.NewInMemoryCheckStore()
+	config := DefaultHealthSchedulerConfig
+	config.Interval = 0
+	scheduler := NewHealthScheduler(urlStore, checks, &recordingQueue{}, config)
+	defer scheduler.Stop()
+
+	code, _, err := urlStore.SetWithOptions(ctx, "https://example.com", store.SetOptions{UserID: "owner"})
+	if err != nil {
+		t.Fatalf("Failed to set URL: %v", err)
+	}
+
+	checkedAt := time.Now()
+	record := func(outcome Outcome, statusCode int, err error) store.LinkMetadata {
+		t.Helper()
+		checkedAt = checkedAt.Add(time.Minute)
+		result := URLProcessResult{Code: code, URL: "https://example.com", CheckedAt: checkedAt, Outcome: outcome, StatusCode: statusCode, Error: err}
+		if err := scheduler.Record(ctx, result); err != nil {
+			t.Fatalf("Failed to record result: %v", err)
+		}
+		entry, err := urlStore.Lookup(ctx, code)
+		if err != nil || entry.Metadata == nil {
+			t.Fatalf("Expected metadata, got %+v (%v)", entry.Metadata, err)
+		}
+		return *entry.Metadata
+	}
+	backoff := func(meta store.LinkMetadata, want time.Duration) {
+		t.Helper()
+		if wait := meta.NextCheckAt.Sub(meta.CheckedAt); wait < want || wait > want+want/10 {
+			t.Errorf("Expected the next check in %s plus jitter, got %s", want, wait)
+		}
+	}
+
+	meta := record(OutcomeOK, http.StatusOK, nil)
+	if meta.Health != store.LinkHealthy || meta.Failures != 0 || !meta.HealthSince.Equal(checkedAt) {
+		t.Errorf("Expected a healthy link, got %+v", meta)
+	}
+	backoff(meta, config.MinInterval)
+
+	// One failure is not enough to call a link broken
+	meta = record(OutcomeFailed, 0, errors.New("connection refused"))
+	if meta.Health != store.LinkHealthy || meta.Failures != 1 {
+		t.Errorf("Expected a healthy link with 1 failure, got %+v", meta)
+	}
+	backoff(meta, config.MinInterval)
+
+	meta = record(OutcomeOK, http.StatusNotFound, nil)
+	if meta.Health != store.LinkBroken || meta.Failures != 2 || !meta.HealthSince.Equal(checkedAt) {
+		t.Errorf("Expected a broken link since this check, got %+v", meta)
+	}
+	backoff(meta, 2*config.MinInterval)
+
+	meta = record(OutcomeBlocked, 0, errors.New("blocked"))
+	if meta.Health != store.LinkBroken || meta.Failures != 3 {
+		t.Errorf("Expected a broken link with 3 failures, got %+v", meta)
+	}
+	backoff(meta, 4*config.MinInterval)
+	brokenSince := *meta.HealthSince
+
+	// Bot defences do not count as failures
+	meta = record(OutcomeOK, http.StatusForbidden, nil)
+	if meta.Health != store.LinkHealthy || meta.Failures != 0 || !meta.HealthSince.After(brokenSince) {
+		t.Errorf("Expected the link to recover, got %+v", meta)
+	}
+
+	if broken, recovered := scheduler.Transitions(); broken != 1 || recovered != 1 {
+		t.Errorf("Expected 1 broken and 1 recovered transition, got %d and %d", broken, recovered)
+	}
+
+	history, err := checks.CheckHistory(code, 10)
+	if err != nil || len(history) != 5 {
+		t.Fatalf("Expected 5 checks in the history, got %d (%v)", len(history), err)
+	}
+	if history[0].Health != store.LinkHealthy || history[0].URL != "https://example.com" ||
+		history[1].Health != store.LinkBroken || history[1].Status != store.CheckBlocked {
+		t.Errorf("Expected the history newest first, got %+v", history)
+	}
+
+	// A result for an old destination is ignored
+	if err := urlStore.Update(ctx, code, "https://example.org", "owner"); err != nil {
+		t.Fatalf("Failed to update URL: %v", err)
+	}
+	stale := URLProcessResult{Code: code, URL: "https://example.com", CheckedAt: time.Now(), Outcome: OutcomeFailed}
+	if err := scheduler.Record(ctx, stale); err != nil {
+		t.Fatalf("Failed to record result: %v", err)
+	}
+	if history, _ := checks.CheckHistory(code, 10); len(history) != 5 {
+		t.Errorf("Expected a stale result to stay out of the history, got %d checks", len(history))
+	}
+}
+
+func TestHealthScheduler_NextIntervalByAge(t *testing.T) {
+	scheduler := &HealthScheduler{config: DefaultHealthSchedulerConfig}
+	now := time.Now()
+
+	tests := []struct {
+		age  time.Duration
+		want time.Duration
+	}{
+		{time.Minute, time.Hour},
+		{24 * time.Hour, 6 * time.Hour},
+		{365 * 24 * time.Hour, 7 * 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		entry := store.URLEntry{CreatedAt: now.Add(-tt.age)}
+		if got := scheduler.nextInterval(entry, 0, now); got < tt.want || got > tt.want+tt.want/10 {
+			t.Errorf("Link aged %s: expected %s plus jitter, got %s", tt.age, tt.want, got)
+		}
+	}
+}
+
+func TestHealthScheduler_Poll(t *testing.T) {
+	ctx := context.Background()
+	urlStore := store.NewInMemoryURLStore()
+	queue := &recordingQueue{}
+	config := DefaultHealthSchedulerConfig
+	config.Interval = 0
+	scheduler := NewHealthScheduler(urlStore, nil, queue, config)
+	defer scheduler.Stop()
+
+	fresh, _, _ := urlStore.SetWithOptions(ctx, "https://example.com/fresh", store.SetOptions{UserID: "owner"})
+	due, _, _ := urlStore.SetWithOptions(ctx, "https://example.com/due", store.SetOptions{UserID: "owner"})
+	past := time.Now().Add(-time.Minute)
+	if err := urlStore.SetMetadata(ctx, due, "https://example.com/due", store.LinkMetadata{CheckedAt: past, Status: store.CheckOK, NextCheckAt: &past}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+
+	// A full queue leaves the link due for the next poll
+	queue.full = true
+	scheduler.poll()
+	queue.full = false
+
+	// The new link still has its creation check coming
+	scheduler.poll()
+	if len(queue.jobs) != 1 || queue.jobs[0] != (URLJob{Code: due, URL: "https://example.com/due"}) {
+		t.Fatalf("Expected only %s to be queued, got %v (fresh link %s)", due, queue.jobs, fresh)
+	}
+
+	// Nothing is queued twice while a check is outstanding
+	scheduler.poll()
+	if len(queue.jobs) != 1 {
+		t.Fatalf("Expected a pending link not to be queued again, got %v", queue.jobs)
+	}
+
+	result := URLProcessResult{Code: due, URL: "https://example.com/due", CheckedAt: time.Now(), Outcome: OutcomeOK, StatusCode: http.StatusOK}
+	if err := scheduler.Record(ctx, result); err != nil {
+		t.Fatalf("Failed to record result: %v", err)
+	}
+	scheduler.poll()
+	if len(queue.jobs) != 1 {
+		t.Errorf("Expected a checked link not to be due, got %v", queue.jobs)
+	}
+}
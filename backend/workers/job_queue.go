@@ -0,0 +1,236 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+// JobRetryConfig configures how a URLProcessor works a durable JobQueue.
+type JobRetryConfig struct {
+	// MaxAttempts is how many times a job is tried before it is
+	// dead-lettered. A lease that expires counts as an attempt, so a job
+	// whose worker keeps dying is given up on too.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled for each
+	// further one up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Visibility is how long a lease hides a job from other workers. It
+	// must comfortably exceed the time a check takes.
+	Visibility time.Duration
+	// PollInterval is how often an idle processor looks for jobs queued
+	// by other processes or due for a retry.
+	PollInterval time.Duration
+}
+
+var DefaultJobRetry = JobRetryConfig{
+	MaxAttempts:  5,
+	Backoff:      30 * time.Second,
+	MaxBackoff:   30 * time.Minute,
+	Visibility:   time.Minute,
+	PollInterval: time.Second,
+}
+
+func (c JobRetryConfig) withDefaults() JobRetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = DefaultJobRetry.MaxAttempts
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = DefaultJobRetry.Backoff
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = DefaultJobRetry.MaxBackoff
+	}
+	if c.Visibility <= 0 {
+		c.Visibility = DefaultJobRetry.Visibility
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = DefaultJobRetry.PollInterval
+	}
+	return c
+}
+
+// enqueue adds a job to the durable queue. A job already queued for the
+// same destination counts as accepted.
+func (p *URLProcessor) enqueue(code, urlString string) bool {
+	queued, err := p.queue.Enqueue(context.Background(), code, urlString)
+	if err != nil {
+		log.Printf("Error queueing URL job for %s, dropping it: %v", code, err)
+		p.dropped.Add(1)
+		return false
+	}
+
+	if queued {
+		p.statsMutex.Lock()
+		p.jobStats.Queued++
+		p.statsMutex.Unlock()
+		select {
+		case p.jobReady <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// refreshJobStats reads the queue's stats. The lock is held throughout, so
+// a job enqueued meanwhile is counted by the read or added after it, never
+// lost.
+func (p *URLProcessor) refreshJobStats() {
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+
+	stats, err := p.queue.JobStats(p.ctx, time.Now())
+	if err != nil {
+		log.Printf("Error reading URL job queue stats: %v", err)
+		return
+	}
+	p.jobStats = stats
+}
+
+func (p *URLProcessor) queuedJobs() int {
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+	return p.jobStats.Queued
+}
+
+// leaseJobs leases jobs from the durable queue for as many workers as are
+// free, and waits for a local enqueue or the poll interval when there is
+// nothing to do. Leases are taken with the processor's context, so Stop
+// does not wait on a stalled database.
+func (p *URLProcessor) leaseJobs() {
+	defer p.feedWG.Done()
+
+	for {
+		p.refreshJobStats()
+
+		free := cap(p.jobs) - len(p.jobs)
+		leased := 0
+		if free > 0 {
+			jobs, err := p.queue.Lease(p.ctx, p.workerID, time.Now(), p.retry.Visibility, free)
+			if err != nil && p.ctx.Err() == nil {
+				log.Printf("Error leasing URL jobs: %v", err)
+			}
+			for i := range jobs {
+				job := jobs[i]
+				if job.Attempts > p.retry.MaxAttempts {
+					reason := fmt.Sprintf("no result after %d attempts, last error: %s", p.retry.MaxAttempts, job.LastError)
+					if err := p.deadLetter(job, reason); err != nil {
+						log.Printf("Error dead-lettering URL job for %s: %v", job.Code, err)
+					}
+					continue
+				}
+				select {
+				case p.jobs <- URLJob{Code: job.Code, URL: job.URL, lease: &job}:
+				case <-p.ctx.Done():
+					p.release(job)
+				}
+			}
+			leased = len(jobs)
+		}
+
+		// A full batch suggests more jobs are waiting.
+		if free > 0 && leased == free && p.ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-p.jobReady:
+		case <-time.After(p.retry.PollInterval):
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// settle records the outcome of a leased job in the queue: done, due for a
+// retry, or dead-lettered after its last attempt. It reports whether the
+// result is final and should be published.
+//
+// Settling, like releasing, is not cut short by Stop, since the work is
+// already done; the queue's own timeouts bound it.
+func (p *URLProcessor) settle(job store.Job, result URLProcessResult) bool {
+	ctx := context.Background()
+
+	var err error
+	final := true
+	switch {
+	case !retryable(result):
+		err = p.queue.Complete(ctx, job)
+	case job.Attempts < p.retry.MaxAttempts:
+		final = false
+		err = p.queue.Retry(ctx, job, time.Now().Add(p.backoff(job.Attempts)), describeResult(result))
+		if err == nil {
+			p.retried.Add(1)
+		}
+	default:
+		err = p.deadLetter(job, describeResult(result))
+	}
+
+	switch err {
+	case nil:
+	case store.ErrLeaseLost:
+		// The lease ran out and another worker may be checking the link
+		// now; the result is left to it.
+		log.Printf("Lease on URL job for %s expired before it was settled", job.Code)
+		return false
+	default:
+		log.Printf("Error settling URL job for %s: %v", job.Code, err)
+	}
+
+	return final
+}
+
+func (p *URLProcessor) deadLetter(job store.Job, reason string) error {
+	err := p.queue.DeadLetter(context.Background(), job, time.Now(), reason)
+	if err == nil {
+		p.deadLettered.Add(1)
+		log.Printf("Gave up on URL job for %s after %d attempts: %s", job.Code, job.Attempts, reason)
+	}
+	return err
+}
+
+// release returns a leased job that was never finished to the queue, ready
+// to be leased again at once. The lease does not count as an attempt, so
+// restarts that interrupt checks do not dead-letter healthy jobs.
+func (p *URLProcessor) release(job store.Job) {
+	if err := p.queue.Release(context.Background(), job); err != nil && err != store.ErrLeaseLost {
+		log.Printf("Error returning URL job for %s to the queue: %v", job.Code, err)
+	}
+}
+
+// backoff returns the wait before retrying a job that has failed attempts
+// times: Backoff doubled for each attempt after the first, bounded by
+// MaxBackoff, with up to 10% jitter so failed jobs do not retry together.
+func (p *URLProcessor) backoff(attempts int) time.Duration {
+	wait := p.retry.Backoff
+	for i := 1; i < attempts && wait < p.retry.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > p.retry.MaxBackoff {
+		wait = p.retry.MaxBackoff
+	}
+
+	return wait + time.Duration(rand.Int63n(int64(wait)/10+1))
+}
+
+// retryable reports whether a check may succeed if tried again: the
+// destination could not be reached, was rate limiting, or had a server
+// error. Blocked destinations and other answers are final.
+func retryable(result URLProcessResult) bool {
+	if result.Outcome == OutcomeFailed {
+		return true
+	}
+	return result.Outcome == OutcomeOK && (result.StatusCode == http.StatusTooManyRequests || result.StatusCode >= 500)
+}
+
+func describeResult(result URLProcessResult) string {
+	if result.Error != nil {
+		return result.Error.Error()
+	}
+	return fmt.Sprintf("%d %s", result.StatusCode, http.StatusText(result.StatusCode))
+}
@@ -0,0 +1,188 @@
+package workers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+func newTestJobQueue(t *testing.T) *store.BoltJobQueue {
+	t.Helper()
+
+	queue, err := store.OpenBoltJobQueue(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatalf("Failed to open job queue: %v", err)
+	}
+	t.Cleanup(func() {
+		queue.Close()
+	})
+
+	return queue
+}
+
+func nextResult(t *testing.T, processor *URLProcessor) URLProcessResult {
+	t.Helper()
+
+	select {
+	case result := <-processor.GetResults():
+		return result
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for a result")
+		return URLProcessResult{}
+	}
+}
+
+func TestURLProcessor_DurableQueueRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	queue := newTestJobQueue(t)
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{
+		Workers:         1,
+		AllowedNetworks: allow,
+		Queue:           queue,
+		Retry:           JobRetryConfig{Backoff: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond},
+	})
+	defer processor.Stop()
+
+	if !processor.TryProcess("a", server.URL) {
+		t.Fatal("Expected the job to be accepted")
+	}
+
+	// Only the result of the successful retry is published
+	result := nextResult(t, processor)
+	if result.Code != "a" || result.StatusCode != http.StatusOK {
+		t.Errorf("Expected a 200 for a, got %+v", result)
+	}
+	if stats := processor.QueueStats(); stats.Retried != 1 || stats.DeadLettered != 0 {
+		t.Errorf("Expected 1 retry, got %+v", stats)
+	}
+	if stats, _ := queue.JobStats(context.Background(), time.Now()); stats != (store.JobQueueStats{}) {
+		t.Errorf("Expected an empty queue, got %+v", stats)
+	}
+}
+
+func TestURLProcessor_DurableQueueDeadLetters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	queue := newTestJobQueue(t)
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{
+		Workers:         1,
+		AllowedNetworks: allow,
+		Queue:           queue,
+		Retry:           JobRetryConfig{MaxAttempts: 2, Backoff: 10 * time.Millisecond, PollInterval: 10 * time.Millisecond},
+	})
+	defer processor.Stop()
+
+	processor.TryProcess("a", server.URL)
+
+	// The last attempt's result is published as the job is given up on
+	result := nextResult(t, processor)
+	if result.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected a 500, got %+v", result)
+	}
+	dead, err := queue.DeadLetters(context.Background(), 10)
+	if err != nil || len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError != "500 Internal Server Error" {
+		t.Errorf("Expected the job to be dead-lettered after 2 attempts, got %+v (%v)", dead, err)
+	}
+}
+
+func TestURLProcessor_DurableQueueSurvivesRestart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	queue := newTestJobQueue(t)
+
+	// Without workers the jobs stay queued until the processor stops
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{Queue: queue, QueueSize: 1})
+	processor.TryProcess("a", server.URL+"/a")
+	if processor.Offer("b", server.URL+"/b") {
+		t.Error("Expected Offer to respect the queue size")
+	}
+	processor.TryProcess("b", server.URL+"/b")
+	processor.Stop()
+
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor = NewURLProcessorWithConfig(URLProcessorConfig{Workers: 2, AllowedNetworks: allow, Queue: queue})
+	defer processor.Stop()
+
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		seen[nextResult(t, processor).Code] = true
+	}
+	if !seen["a"] || !seen["b"] {
+		t.Errorf("Expected jobs a and b after the restart, got %v", seen)
+	}
+}
+
+func TestURLProcessor_StopReleasesWithoutAttempt(t *testing.T) {
+	started := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	queue := newTestJobQueue(t)
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{
+		Workers:         1,
+		AllowedNetworks: allow,
+		Queue:           queue,
+		Retry:           JobRetryConfig{PollInterval: 10 * time.Millisecond},
+	})
+
+	processor.TryProcess("a", server.URL)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the check to start")
+	}
+	processor.Stop()
+
+	// The interrupted check is not counted against the job's attempts
+	leased, err := queue.Lease(context.Background(), "next", time.Now(), time.Minute, 10)
+	if err != nil || len(leased) != 1 || leased[0].Attempts != 1 {
+		t.Errorf("Expected job a on its first attempt, got %+v (%v)", leased, err)
+	}
+}
+
+func TestURLProcessor_Backoff(t *testing.T) {
+	processor := &URLProcessor{retry: JobRetryConfig{Backoff: time.Second, MaxBackoff: 10 * time.Second}}
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{10, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := processor.backoff(tt.attempts); got < tt.want || got > tt.want+tt.want/10 {
+			t.Errorf("Attempt %d: expected %s plus jitter, got %s", tt.attempts, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package workers
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// PageMetadata is what a destination's HTML says about itself, for link
+// previews.
+type PageMetadata struct {
+	Title       string // <title>
+	OGTitle     string // og:title
+	Description string // og:description, or the description meta tag
+	Image       string // og:image, as an absolute URL
+	Favicon     string // the first icon link, as an absolute URL
+}
+
+// Limits on extracted text, so a hostile page cannot bloat the store.
+const (
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxMetaURLLength     = 2048
+)
+
+// parsePage reads the head of an HTML document from r, decoding it from
+// the charset declared in contentType or the document itself. Relative
+// image and icon URLs are resolved against base. Parsing stops at the
+// start of the body, since everything it looks for lives in the head.
+func parsePage(r io.Reader, contentType string, base *url.URL) (PageMetadata, error) {
+	decoded, err := charset.NewReader(r, contentType)
+	if err != nil {
+		return PageMetadata{}, err
+	}
+
+	var page PageMetadata
+	var description string
+	tokenizer := html.NewTokenizer(decoded)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return page.finish(description, base), err
+			}
+			return page.finish(description, base), nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "body":
+				return page.finish(description, base), nil
+			case "title":
+				if page.Title == "" && tokenizer.Next() == html.TextToken {
+					page.Title = clean(string(tokenizer.Text()), maxTitleLength)
+				}
+			case "meta":
+				if !hasAttr {
+					continue
+				}
+				attrs := attributes(tokenizer)
+				key := attrs["property"]
+				if key == "" {
+					key = attrs["name"]
+				}
+				content := attrs["content"]
+				switch strings.ToLower(key) {
+				case "og:title":
+					page.OGTitle = clean(content, maxTitleLength)
+				case "og:description":
+					page.Description = clean(content, maxDescriptionLength)
+				case "description":
+					description = clean(content, maxDescriptionLength)
+				case "og:image", "og:image:url", "og:image:secure_url":
+					if page.Image == "" {
+						page.Image = resolve(base, content)
+					}
+				}
+			case "link":
+				if !hasAttr || page.Favicon != "" {
+					continue
+				}
+				attrs := attributes(tokenizer)
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					if rel == "icon" || rel == "apple-touch-icon" {
+						page.Favicon = resolve(base, attrs["href"])
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+// finish fills in fallbacks once the head has been read.
+func (p PageMetadata) finish(description string, base *url.URL) PageMetadata {
+	if p.Description == "" {
+		p.Description = description
+	}
+	if p.Favicon == "" && base != nil {
+		p.Favicon = resolve(base, "/favicon.ico")
+	}
+	return p
+}
+
+func attributes(tokenizer *html.Tokenizer) map[string]string {
+	attrs := make(map[string]string)
+	for {
+		key, value, more := tokenizer.TagAttr()
+		attrs[string(key)] = string(value)
+		if !more {
+			return attrs
+		}
+	}
+}
+
+// clean collapses whitespace in s and truncates it to at most max bytes,
+// without splitting a character.
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= max {
+		return s
+	}
+
+	// Back up while the cut would fall inside a multi-byte character.
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// resolve makes ref absolute against base, returning "" for anything that
+// is not an http or https URL, such as a javascript: or data: URI.
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || base == nil {
+		return ""
+	}
+
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	if s := u.String(); len(s) <= maxMetaURLLength {
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,133 @@
+package workers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParsePage(t *testing.T) {
+	base, _ := url.Parse("https://example.com/articles/1")
+	doc := `<!DOCTYPE html>
+<html><head>
+  <title>
+    Fallback   title
+  </title>
+  <meta property="og:title" content="Open Graph title">
+  <meta name="description" content="Plain description">
+  <meta property="og:image" content="/images/preview.png">
+  <link rel="shortcut icon" href="static/icon.png">
+</head>
+<body><meta property="og:description" content="Not in the head"></body></html>`
+
+	page, err := parsePage(strings.NewReader(doc), "text/html; charset=utf-8", base)
+	if err != nil {
+		t.Fatalf("Failed to parse page: %v", err)
+	}
+
+	want := PageMetadata{
+		Title:       "Fallback title",
+		OGTitle:     "Open Graph title",
+		Description: "Plain description",
+		Image:       "https://example.com/images/preview.png",
+		Favicon:     "https://example.com/articles/static/icon.png",
+	}
+	if page != want {
+		t.Errorf("Expected %+v, got %+v", want, page)
+	}
+}
+
+func TestParsePage_Charset(t *testing.T) {
+	// "Café" in ISO-8859-1, declared only by the document
+	doc := "<html><head><meta charset=\"iso-8859-1\"><title>Caf\xe9</title></head></html>"
+
+	page, err := parsePage(strings.NewReader(doc), "text/html", nil)
+	if err != nil {
+		t.Fatalf("Failed to parse page: %v", err)
+	}
+	if page.Title != "Café" {
+		t.Errorf("Expected the title to be decoded, got %q", page.Title)
+	}
+
+	// A charset in the Content-Type header wins
+	doc = "<html><head><title>\xcf\xf0\xe8\xe2\xe5\xf2</title></head></html>"
+	page, _ = parsePage(strings.NewReader(doc), "text/html; charset=windows-1251", nil)
+	if page.Title != "Привет" {
+		t.Errorf("Expected the title to be decoded, got %q", page.Title)
+	}
+}
+
+func TestParsePage_Sanitizes(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	doc := fmt.Sprintf(`<head><title>%s</title>
+<meta property="og:image" content="javascript:alert(1)">
+<link rel="icon" href="data:image/png;base64,AAAA">`, strings.Repeat("é", maxTitleLength))
+
+	page, err := parsePage(strings.NewReader(doc), "text/html; charset=utf-8", base)
+	if err != nil {
+		t.Fatalf("Failed to parse page: %v", err)
+	}
+	if len(page.Title) > maxTitleLength || !strings.HasPrefix(page.Title, "éé") || strings.ContainsRune(page.Title, '�') {
+		t.Errorf("Expected the title to be truncated on a character boundary, got %d bytes", len(page.Title))
+	}
+	if page.Image != "" {
+		t.Errorf("Expected a javascript: image to be dropped, got %q", page.Image)
+	}
+	if page.Favicon != "https://example.com/favicon.ico" {
+		t.Errorf("Expected a data: icon to fall back to /favicon.ico, got %q", page.Favicon)
+	}
+}
+
+func TestURLProcessor_FetchesPage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/head-refused":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+		case "/file":
+			w.Header().Set("Content-Type", "application/pdf")
+			if r.Method == http.MethodGet {
+				t.Error("Expected no GET for a non-HTML destination")
+			}
+			return
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, "<head><!-- %s --><title>Too far</title></head>", strings.Repeat("x", 4096))
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<head><title>Example</title><meta property="og:description" content="An example page"></head>`)
+	}))
+	defer server.Close()
+
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{Workers: 1, AllowedNetworks: allow, MaxPageBytes: 1024})
+	defer processor.Stop()
+
+	for _, path := range []string{"/", "/head-refused"} {
+		result := processor.processURL(server.URL + path)
+		if result.Outcome != OutcomeOK || result.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected a successful check, got %s %d (%v)", path, result.Outcome, result.StatusCode, result.Error)
+		}
+		if result.Title != "Example" || result.Page.Description != "An example page" {
+			t.Errorf("%s: expected page metadata, got title %q and %+v", path, result.Title, result.Page)
+		}
+		if want := server.URL + "/favicon.ico"; result.Page.Favicon != want {
+			t.Errorf("%s: expected favicon %q, got %q", path, want, result.Page.Favicon)
+		}
+	}
+
+	if result := processor.processURL(server.URL + "/file"); result.Title != "" || result.ContentType != "application/pdf" {
+		t.Errorf("Expected only a HEAD check for a PDF, got title %q and content type %q", result.Title, result.ContentType)
+	}
+
+	// Only MaxPageBytes of the body are read
+	if result := processor.processURL(server.URL + "/large"); result.Outcome != OutcomeOK || result.Title != "" {
+		t.Errorf("Expected the title past the limit to be ignored, got %s %q", result.Outcome, result.Title)
+	}
+}
@@ -0,0 +1,100 @@
+package workers
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Spill holds the jobs a full URLProcessor queue had no room for under
+// OverflowSpill, until workers catch up.
+type Spill interface {
+	Push(job URLJob) error
+	// Pop removes and returns the oldest job; ok is false if there is none.
+	Pop() (job URLJob, ok bool, err error)
+	Len() int
+}
+
+var spillBucket = []byte("jobs")
+
+// BoltSpill keeps spilled jobs in a bbolt file, in the order they were
+// pushed, so they survive a restart.
+type BoltSpill struct {
+	db *bolt.DB
+}
+
+func OpenBoltSpill(path string) (*BoltSpill, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(spillBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize %s: %w", path, err)
+	}
+
+	return &BoltSpill{db: db}, nil
+}
+
+func (s *BoltSpill) Push(job URLJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(spillBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		return bucket.Put(binary.BigEndian.AppendUint64(nil, seq), data)
+	})
+}
+
+func (s *BoltSpill) Pop() (URLJob, bool, error) {
+	var job URLJob
+	var ok bool
+	var decodeErr error
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(spillBucket).Cursor()
+		key, data := cursor.First()
+		if key == nil {
+			return nil
+		}
+		// A record that cannot be decoded is still removed, rather than
+		// left to block the jobs behind it.
+		decodeErr = json.Unmarshal(data, &job)
+		ok = decodeErr == nil
+		return cursor.Delete()
+	})
+	if err != nil {
+		return URLJob{}, false, err
+	}
+	if decodeErr != nil {
+		return URLJob{}, false, fmt.Errorf("dropped undecodable spilled job: %w", decodeErr)
+	}
+
+	return job, ok, nil
+}
+
+func (s *BoltSpill) Len() int {
+	count := 0
+	s.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(spillBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+func (s *BoltSpill) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,127 @@
+package workers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBoltSpill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.db")
+	spill, err := OpenBoltSpill(path)
+	if err != nil {
+		t.Fatalf("Failed to open spill: %v", err)
+	}
+
+	for _, code := range []string{"a", "b", "c"} {
+		if err := spill.Push(URLJob{Code: code, URL: "https://example.com/" + code}); err != nil {
+			t.Fatalf("Failed to push job: %v", err)
+		}
+	}
+	if job, ok, err := spill.Pop(); err != nil || !ok || job.Code != "a" {
+		t.Errorf("Expected job a first, got %+v %v (%v)", job, ok, err)
+	}
+
+	// Jobs survive reopening the file
+	spill.Close()
+	spill, err = OpenBoltSpill(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen spill: %v", err)
+	}
+	defer spill.Close()
+
+	if spill.Len() != 2 {
+		t.Errorf("Expected 2 spilled jobs, got %d", spill.Len())
+	}
+	for _, want := range []string{"b", "c"} {
+		if job, ok, err := spill.Pop(); err != nil || !ok || job.Code != want {
+			t.Errorf("Expected job %s, got %+v %v (%v)", want, job, ok, err)
+		}
+	}
+	if _, ok, err := spill.Pop(); ok || err != nil {
+		t.Errorf("Expected an empty spill, got %v (%v)", ok, err)
+	}
+}
+
+func TestURLProcessor_Overflow(t *testing.T) {
+	// Without workers nothing leaves the queue
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{QueueSize: 1})
+	defer processor.Stop()
+
+	if !processor.TryProcess("a", "https://example.com/a") {
+		t.Fatal("Expected the first job to be queued")
+	}
+	if processor.TryProcess("b", "https://example.com/b") {
+		t.Error("Expected a job beyond the queue size to be dropped")
+	}
+	processor.ProcessURL("c", "https://example.com/c")
+	if stats := processor.QueueStats(); stats.Depth != 1 || stats.Capacity != 1 || stats.Dropped != 2 {
+		t.Errorf("Expected 1 queued and 2 dropped jobs, got %+v", stats)
+	}
+	if processor.Overloaded() {
+		t.Error("Expected only the reject policy to report overload")
+	}
+
+	processor = NewURLProcessorWithConfig(URLProcessorConfig{QueueSize: 1, Overflow: OverflowReject})
+	defer processor.Stop()
+
+	processor.TryProcess("a", "https://example.com/a")
+	if !processor.Overloaded() {
+		t.Error("Expected a full queue to report overload")
+	}
+	if processor.TryProcess("b", "https://example.com/b") {
+		t.Error("Expected a job beyond the queue size to be rejected")
+	}
+	if stats := processor.QueueStats(); stats.Rejected != 1 || stats.Dropped != 0 {
+		t.Errorf("Expected 1 rejected job, got %+v", stats)
+	}
+}
+
+func TestURLProcessor_Spill(t *testing.T) {
+	spill, err := OpenBoltSpill(filepath.Join(t.TempDir(), "spill.db"))
+	if err != nil {
+		t.Fatalf("Failed to open spill: %v", err)
+	}
+	defer spill.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	processor := NewURLProcessorWithConfig(URLProcessorConfig{QueueSize: 1, Overflow: OverflowSpill, Spill: spill})
+	for _, code := range []string{"a", "b", "c"} {
+		if !processor.TryProcess(code, server.URL+"/"+code) {
+			t.Fatalf("Expected job %s to be accepted", code)
+		}
+	}
+	if stats := processor.QueueStats(); stats.Spilled != 2 || stats.Dropped != 0 {
+		t.Errorf("Expected 2 spilled jobs, got %+v", stats)
+	}
+
+	// Stopping keeps every job, queued or spilled, for the next start
+	processor.Stop()
+	if spill.Len() != 3 {
+		t.Fatalf("Expected 3 jobs in the spill after stopping, got %d", spill.Len())
+	}
+
+	allow, _ := ParseAllowedNetworks("127.0.0.0/8")
+	processor = NewURLProcessorWithConfig(URLProcessorConfig{Workers: 1, AllowedNetworks: allow, Overflow: OverflowSpill, Spill: spill})
+	defer processor.Stop()
+
+	seen := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(seen) < 3 {
+		select {
+		case result := <-processor.GetResults():
+			if result.Outcome != OutcomeOK {
+				t.Errorf("Expected job %s to succeed, got %s (%v)", result.Code, result.Outcome, result.Error)
+			}
+			seen[result.Code] = true
+		case <-timeout:
+			t.Fatalf("Timed out waiting for spilled jobs, got %v", seen)
+		}
+	}
+}
@@ -2,47 +2,236 @@ package workers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/priyankeshh/url-shortener/backend/store"
+)
+
+// Outcome classifies a URLProcessResult.
+type Outcome string
+
+const (
+	// OutcomeOK means the destination answered, whatever its status code.
+	OutcomeOK Outcome = "ok"
+	// OutcomeFailed means the destination could not be reached.
+	OutcomeFailed Outcome = "failed"
+	// OutcomeBlocked means the destination, or a redirect from it, pointed
+	// at an internal address and was not contacted. Error is a
+	// *BlockedError.
+	OutcomeBlocked Outcome = "blocked"
 )
 
+// URLJob asks for the destination of a link to be checked.
+type URLJob struct {
+	Code string
+	URL  string
+	// lease is the durable queue's job, for jobs leased from one.
+	lease *store.Job
+}
+
 type URLProcessResult struct {
-	URL         string
-	StatusCode  int
+	Code       string
+	URL        string
+	CheckedAt  time.Time
+	Outcome    Outcome
+	StatusCode int
+	// Title is the page's og:title, or its <title> if it has none.
 	Title       string
+	Page        PageMetadata
 	ContentType string
 	Error       error
 	ProcessTime time.Duration
 }
 
+// URLProcessorConfig configures NewURLProcessorWithConfig.
+type URLProcessorConfig struct {
+	Workers int
+	// AllowedNetworks are internal ranges that may be fetched despite the
+	// SSRF guard, which otherwise refuses loopback, private, link-local
+	// and cloud metadata addresses.
+	AllowedNetworks AllowedNetworks
+	// MaxPageBytes bounds how much of an HTML destination is downloaded to
+	// read its title and preview metadata. Zero disables the download and
+	// leaves only the HEAD check.
+	MaxPageBytes int64
+	// QueueSize is how many jobs may wait for a worker; zero means twice
+	// the number of workers.
+	QueueSize int
+	// Overflow decides what happens to a job when the queue is full; the
+	// zero value is OverflowDrop. Spill receives the jobs under
+	// OverflowSpill.
+	Overflow OverflowPolicy
+	Spill    Spill
+	// Queue, if set, keeps jobs in a durable JobQueue instead of memory,
+	// so they survive restarts and are shared by every process using it.
+	// QueueSize then bounds how many queued jobs Offer allows, and
+	// Overflow and Spill do not apply.
+	Queue store.JobQueue
+	// WorkerID names this processor's leases on Queue; it defaults to the
+	// host name and process ID.
+	WorkerID string
+	// Retry configures leases and retries on Queue; zero fields take their
+	// value from DefaultJobRetry.
+	Retry JobRetryConfig
+}
+
+// OverflowPolicy is what TryProcess does with a job the queue has no room
+// for.
+type OverflowPolicy string
+
+const (
+	// OverflowDrop discards the job and counts it as dropped.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowSpill writes the job to the configured Spill, from which it
+	// is queued again as workers free up.
+	OverflowSpill OverflowPolicy = "spill"
+	// OverflowReject refuses the job and counts it as rejected. Overloaded
+	// reports true while the queue is full, so callers can turn new work
+	// away before creating it.
+	OverflowReject OverflowPolicy = "reject"
+)
+
+// ParseOverflowPolicy parses the name of an OverflowPolicy.
+func ParseOverflowPolicy(name string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(name); policy {
+	case OverflowDrop, OverflowSpill, OverflowReject:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown overflow policy %q: must be drop, spill or reject", name)
+}
+
+// QueueStats describes the job queue of a URLProcessor.
+type QueueStats struct {
+	Depth    int
+	Capacity int
+	// Dropped, Rejected and Spilled count jobs since the processor
+	// started that found the queue full.
+	Dropped  int64
+	Rejected int64
+	Spilled  int64
+	// SpillDepth is the number of spilled jobs waiting to be queued.
+	SpillDepth int
+	// Leased, DeadLetters, Retried and DeadLettered describe a durable
+	// Queue. The counters cover this processor's workers only.
+	Leased       int
+	DeadLetters  int
+	Retried      int64
+	DeadLettered int64
+}
+
+// DefaultMaxPageBytes comfortably covers the head of real pages, where the
+// preview metadata lives.
+const DefaultMaxPageBytes = 512 << 10
+
 type URLProcessor struct {
-	workerCount int
-	client      *http.Client
-	jobs        chan string
-	results     chan URLProcessResult
-	wg          sync.WaitGroup
-	ctx         context.Context
-	cancel      context.CancelFunc
+	workerCount  int
+	maxPageBytes int64
+	client       *http.Client
+	jobs         chan URLJob
+	capacity     int
+	results      chan URLProcessResult
+	overflow     OverflowPolicy
+	spill        Spill
+	spillReady   chan struct{}
+	queue        store.JobQueue
+	workerID     string
+	retry        JobRetryConfig
+	jobReady     chan struct{}
+	jobStats     store.JobQueueStats
+	statsMutex   sync.Mutex
+	dropped      atomic.Int64
+	rejected     atomic.Int64
+	spilled      atomic.Int64
+	retried      atomic.Int64
+	deadLettered atomic.Int64
+	wg           sync.WaitGroup
+	feedWG       sync.WaitGroup
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
 func NewURLProcessor(workerCount int) *URLProcessor {
+	return NewURLProcessorWithConfig(URLProcessorConfig{
+		Workers:      workerCount,
+		MaxPageBytes: DefaultMaxPageBytes,
+	})
+}
+
+func NewURLProcessorWithConfig(config URLProcessorConfig) *URLProcessor {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = config.Workers * 2
+	}
+	overflow := config.Overflow
+	if overflow == "" || (overflow == OverflowSpill && config.Spill == nil) || config.Queue != nil {
+		overflow = OverflowDrop
+	}
+	// Jobs leased from a durable queue wait in memory only until a worker
+	// is free, so their leases do not run out before they start.
+	buffered := queueSize
+	if config.Queue != nil {
+		buffered = config.Workers
+	}
+	workerID := config.WorkerID
+	if workerID == "" {
+		host, _ := os.Hostname()
+		workerID = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+
+	// The transport ignores proxy settings, since a proxy would make the
+	// connection, and the guard would only ever see the proxy's address.
+	transport := &http.Transport{
+		DialContext:           guardedDial(&net.Dialer{Timeout: 5 * time.Second}, config.AllowedNetworks),
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		MaxIdleConns:          config.Workers,
+		IdleConnTimeout:       30 * time.Second,
+	}
+
 	processor := &URLProcessor{
-		workerCount: workerCount,
+		workerCount:  config.Workers,
+		maxPageBytes: config.MaxPageBytes,
 		client: &http.Client{
-			Timeout: 5 * time.Second,
+			Transport:     transport,
+			CheckRedirect: checkRedirect(config.AllowedNetworks),
+			Timeout:       5 * time.Second,
 		},
-		jobs:    make(chan string, workerCount*2),
-		results: make(chan URLProcessResult, workerCount*2),
-		ctx:     ctx,
-		cancel:  cancel,
+		jobs:       make(chan URLJob, buffered),
+		capacity:   queueSize,
+		results:    make(chan URLProcessResult, config.Workers*2),
+		overflow:   overflow,
+		spill:      config.Spill,
+		spillReady: make(chan struct{}, 1),
+		queue:      config.Queue,
+		workerID:   workerID,
+		retry:      config.Retry.withDefaults(),
+		jobReady:   make(chan struct{}, 1),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
 
 	processor.startWorkers()
+	switch {
+	case config.Queue != nil:
+		processor.feedWG.Add(1)
+		go processor.leaseJobs()
+	case overflow == OverflowSpill:
+		processor.feedWG.Add(1)
+		go processor.drainSpill()
+	}
 
 	return processor
 }
@@ -69,13 +258,25 @@ func (p *URLProcessor) worker(id int) {
 		case <-p.ctx.Done():
 			log.Printf("URL processor worker %d stopping due to context cancellation", id)
 			return
-		case urlString, ok := <-p.jobs:
+		case job, ok := <-p.jobs:
 			if !ok {
 				log.Printf("URL processor worker %d stopping due to closed jobs channel", id)
 				return
 			}
 
-			result := p.processURL(urlString)
+			result := p.processURL(job.URL)
+			result.Code = job.Code
+
+			if job.lease != nil {
+				// A check cut short by Stop is left for the next start.
+				if p.ctx.Err() != nil {
+					p.release(*job.lease)
+					return
+				}
+				if !p.settle(*job.lease, result) {
+					continue
+				}
+			}
 
 			select {
 			case p.results <- result:
@@ -90,11 +291,13 @@ func (p *URLProcessor) worker(id int) {
 func (p *URLProcessor) processURL(urlString string) URLProcessResult {
 	startTime := time.Now()
 	result := URLProcessResult{
-		URL: urlString,
+		URL:       urlString,
+		CheckedAt: startTime,
 	}
 
 	parsedURL, err := url.Parse(urlString)
 	if err != nil {
+		result.Outcome = OutcomeFailed
 		result.Error = err
 		result.ProcessTime = time.Since(startTime)
 		return result
@@ -108,42 +311,264 @@ func (p *URLProcessor) processURL(urlString string) URLProcessResult {
 	ctx, cancel := context.WithTimeout(p.ctx, 5*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodHead, urlString, nil)
+	resp, err := p.send(ctx, http.MethodHead, urlString)
 	if err != nil {
+		result.Outcome = OutcomeFailed
+		var blocked *BlockedError
+		if errors.As(err, &blocked) {
+			result.Outcome = OutcomeBlocked
+			err = blocked
+		}
 		result.Error = err
 		result.ProcessTime = time.Since(startTime)
 		return result
 	}
+	resp.Body.Close()
+
+	result.Outcome = OutcomeOK
+	result.StatusCode = resp.StatusCode
+	result.ContentType = resp.Header.Get("Content-Type")
+
+	// Some servers refuse HEAD outright, so those get a GET as well.
+	headRefused := resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented
+	if p.maxPageBytes > 0 && (isHTML(result.ContentType) || headRefused) {
+		p.fetchPage(ctx, urlString, &result)
+	}
+
+	result.ProcessTime = time.Since(startTime)
+
+	return result
+}
+
+func (p *URLProcessor) send(ctx context.Context, method, urlString string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, urlString, nil)
+	if err != nil {
+		return nil, err
+	}
 
 	req.Header.Set("User-Agent", "URLShortener/1.0")
+	if method == http.MethodGet {
+		req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+	}
+
+	return p.client.Do(req)
+}
 
-	resp, err := p.client.Do(req)
+// fetchPage GETs an HTML destination and fills in result's page metadata
+// from at most maxPageBytes of the body. Failures leave the HEAD result as
+// it was, since the destination did answer.
+func (p *URLProcessor) fetchPage(ctx context.Context, urlString string, result *URLProcessResult) {
+	resp, err := p.send(ctx, http.MethodGet, urlString)
 	if err != nil {
-		result.Error = err
-		result.ProcessTime = time.Since(startTime)
-		return result
+		return
 	}
 	defer resp.Body.Close()
 
 	result.StatusCode = resp.StatusCode
 	result.ContentType = resp.Header.Get("Content-Type")
-	result.ProcessTime = time.Since(startTime)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || !isHTML(result.ContentType) {
+		return
+	}
 
-	return result
+	// A truncated or malformed document still yields whatever was parsed
+	// before the problem.
+	page, _ := parsePage(io.LimitReader(resp.Body, p.maxPageBytes), result.ContentType, resp.Request.URL)
+	result.Page = page
+	result.Title = page.OGTitle
+	if result.Title == "" {
+		result.Title = page.Title
+	}
 }
 
-func (p *URLProcessor) ProcessURL(urlString string) {
+func isHTML(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// ProcessURL queues a check of urlString, the destination of code. It never
+// blocks; see TryProcess.
+func (p *URLProcessor) ProcessURL(code, urlString string) {
+	p.TryProcess(code, urlString)
+}
+
+// TryProcess queues a check of urlString, the destination of code, without
+// blocking. If the queue is full the overflow policy decides the job's
+// fate, and TryProcess reports whether it was accepted, either queued or
+// spilled. A durable queue is never full.
+func (p *URLProcessor) TryProcess(code, urlString string) bool {
+	if p.queue != nil {
+		return p.enqueue(code, urlString)
+	}
+
+	job := URLJob{Code: code, URL: urlString}
+	if p.Offer(job.Code, job.URL) {
+		return true
+	}
+
+	switch p.overflow {
+	case OverflowSpill:
+		if err := p.spill.Push(job); err != nil {
+			log.Printf("Error spilling URL job for %s, dropping it: %v", code, err)
+			p.dropped.Add(1)
+			return false
+		}
+		p.spilled.Add(1)
+		select {
+		case p.spillReady <- struct{}{}:
+		default:
+		}
+		return true
+	case OverflowReject:
+		p.rejected.Add(1)
+		return false
+	default:
+		p.dropped.Add(1)
+		return false
+	}
+}
+
+// Offer queues a check only if the queue has room, leaving the overflow
+// policy out of it, for callers that will try again later anyway.
+func (p *URLProcessor) Offer(code, urlString string) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+	if p.queue != nil {
+		return p.queuedJobs() < p.capacity && p.enqueue(code, urlString)
+	}
 	select {
-	case p.jobs <- urlString:
-	case <-p.ctx.Done():
+	case p.jobs <- URLJob{Code: code, URL: urlString}:
+		return true
+	default:
+		return false
 	}
 }
 
+// Overloaded reports whether the processor rejects new jobs because its
+// queue is full. It is only ever true under OverflowReject.
+func (p *URLProcessor) Overloaded() bool {
+	return p.overflow == OverflowReject && len(p.jobs) == cap(p.jobs)
+}
+
+// drainSpill moves spilled jobs back onto the queue as it empties.
+func (p *URLProcessor) drainSpill() {
+	defer p.feedWG.Done()
+
+	for {
+		job, ok, err := p.spill.Pop()
+		if err != nil {
+			log.Printf("Error reading spilled URL jobs: %v", err)
+		}
+		if !ok {
+			// Retry after an error even if nothing new is spilled.
+			var retry <-chan time.Time
+			if err != nil {
+				retry = time.After(time.Second)
+			}
+			select {
+			case <-p.spillReady:
+			case <-retry:
+			case <-p.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		select {
+		case p.jobs <- job:
+		case <-p.ctx.Done():
+			if err := p.spill.Push(job); err != nil {
+				log.Printf("Error returning URL job for %s to the spill: %v", job.Code, err)
+			}
+			return
+		}
+	}
+}
+
+// QueueDepth returns the number of URLs waiting for a worker.
+func (p *URLProcessor) QueueDepth() int {
+	if p.queue != nil {
+		return p.queuedJobs()
+	}
+	return len(p.jobs)
+}
+
+// QueueStats describes the queue. The figures for a durable queue are
+// as of the last time it was polled for jobs.
+func (p *URLProcessor) QueueStats() QueueStats {
+	stats := QueueStats{
+		Depth:        len(p.jobs),
+		Capacity:     p.capacity,
+		Dropped:      p.dropped.Load(),
+		Rejected:     p.rejected.Load(),
+		Spilled:      p.spilled.Load(),
+		Retried:      p.retried.Load(),
+		DeadLettered: p.deadLettered.Load(),
+	}
+	if p.spill != nil {
+		stats.SpillDepth = p.spill.Len()
+	}
+	if p.queue != nil {
+		p.statsMutex.Lock()
+		stats.Depth = p.jobStats.Queued
+		stats.Leased = p.jobStats.Leased
+		stats.DeadLetters = p.jobStats.Dead
+		p.statsMutex.Unlock()
+	}
+	return stats
+}
+
 func (p *URLProcessor) GetResults() <-chan URLProcessResult {
 	return p.results
 }
 
+// Stop stops the workers. Under OverflowSpill, jobs still waiting in the
+// queue are written to the spill, so they are checked after a restart.
+// Jobs leased from a durable queue are returned to it.
 func (p *URLProcessor) Stop() {
 	p.cancel()
-	close(p.jobs)
+	p.feedWG.Wait()
+
+	if p.queue == nil && p.overflow != OverflowSpill {
+		return
+	}
+	p.wg.Wait()
+	for {
+		select {
+		case job := <-p.jobs:
+			if job.lease != nil {
+				p.release(*job.lease)
+			} else if err := p.spill.Push(job); err != nil {
+				log.Printf("Error spilling URL job for %s: %v", job.Code, err)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Metadata converts the result into the link metadata kept by the store.
+func (r URLProcessResult) Metadata() store.LinkMetadata {
+	meta := store.LinkMetadata{
+		CheckedAt:   r.CheckedAt,
+		StatusCode:  r.StatusCode,
+		ContentType: r.ContentType,
+		Title:       r.Title,
+		Description: r.Page.Description,
+		ImageURL:    r.Page.Image,
+		FaviconURL:  r.Page.Favicon,
+	}
+	switch r.Outcome {
+	case OutcomeOK:
+		meta.Status = store.CheckOK
+	case OutcomeBlocked:
+		meta.Status = store.CheckBlocked
+	default:
+		meta.Status = store.CheckFailed
+	}
+	if r.Error != nil {
+		meta.Error = r.Error.Error()
+	}
+
+	return meta
 }
@@ -1,4 +1,4 @@
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useMemo } from 'react';
 import Layout from './components/layout/Layout';
 import UrlForm from './components/UrlForm';
 import UrlResult from './components/UrlResult';
@@ -6,7 +6,7 @@ import UrlHistory from './components/UrlHistory';
 import { useUrlShortener } from './hooks/useUrlShortener';
 import { useUrlHistory } from './hooks/useUrlHistory';
 import { useUserUrls } from './hooks/useUserUrls';
-import { UrlHistoryItem } from './types';
+import { LinkMetadata, UrlHistoryItem } from './types';
 import { LinkIcon } from 'lucide-react';
 
 function App() {
@@ -32,6 +32,17 @@ function App() {
     }
   }, [serverUrls, history, addToHistory]);
 
+  // Link previews the backend extracted from each destination page
+  const previews = useMemo(() => {
+    const byShortUrl: Record<string, LinkMetadata> = {};
+    serverUrls.forEach(item => {
+      if (item.metadata) {
+        byShortUrl[item.short_url] = item.metadata;
+      }
+    });
+    return byShortUrl;
+  }, [serverUrls]);
+
   const handleSubmit = async (url: string, alias?: string) => {
     try {
       const result = await shortenUrl(url, alias);
@@ -88,6 +99,7 @@ function App() {
           onClear={clearHistory}
           onRemoveItem={removeFromHistory}
           onSelectItem={handleSelectHistoryItem}
+          previews={previews}
         />
       </div>
     </Layout>
@@ -1,20 +1,23 @@
 import React from 'react';
-import { Clock, ExternalLink, Trash2 } from 'lucide-react';
+import { AlertTriangle, Clock, ExternalLink, Trash2 } from 'lucide-react';
 import Button from './ui/Button';
-import { UrlHistoryItem } from '../types';
+import { LinkMetadata, UrlHistoryItem } from '../types';
 
 interface UrlHistoryProps {
   items: UrlHistoryItem[];
   onClear: () => void;
   onRemoveItem: (id: string) => void;
   onSelectItem: (item: UrlHistoryItem) => void;
+  // Destination metadata from the server, keyed by short URL
+  previews?: Record<string, LinkMetadata>;
 }
 
 const UrlHistory: React.FC<UrlHistoryProps> = ({ 
   items, 
   onClear, 
   onRemoveItem,
-  onSelectItem
+  onSelectItem,
+  previews = {}
 }) => {
   if (items.length === 0) {
     return null;
@@ -50,45 +53,87 @@ const UrlHistory: React.FC<UrlHistoryProps> = ({
       </div>
       
       <div className="space-y-3 max-h-72 overflow-y-auto pr-1">
-        {items.map((item) => (
-          <div 
-            key={item.id}
-            className="bg-white bg-opacity-10 backdrop-blur-sm rounded-lg p-3 border border-purple-300 border-opacity-10 hover:border-opacity-20 transition-all duration-200"
-          >
-            <div className="flex justify-between items-start">
-              <div 
-                className="cursor-pointer flex-1 mr-2"
-                onClick={() => onSelectItem(item)}
-              >
-                <p className="text-white text-sm font-medium truncate">
-                  {item.shortUrl}
-                </p>
-                <p className="text-purple-200 text-xs truncate mt-1">
-                  {item.originalUrl}
-                </p>
-                <p className="text-purple-300 text-xs mt-2 opacity-80">
-                  {formatDate(item.createdAt)}
-                </p>
-              </div>
-              <div className="flex space-x-2">
-                <button 
-                  className="text-purple-200 hover:text-white transition-colors p-1 rounded"
-                  onClick={() => window.open(item.shortUrl, '_blank')}
-                  title="Open shortened URL"
-                >
-                  <ExternalLink size={16} />
-                </button>
-                <button 
-                  className="text-purple-200 hover:text-red-300 transition-colors p-1 rounded"
-                  onClick={() => onRemoveItem(item.id)}
-                  title="Remove from history"
+        {items.map((item) => {
+          const preview = previews[item.shortUrl];
+
+          return (
+            <div 
+              key={item.id}
+              className="bg-white bg-opacity-10 backdrop-blur-sm rounded-lg p-3 border border-purple-300 border-opacity-10 hover:border-opacity-20 transition-all duration-200"
+            >
+              <div className="flex justify-between items-start">
+                <div 
+                  className="cursor-pointer flex-1 mr-2"
+                  onClick={() => onSelectItem(item)}
                 >
-                  <Trash2 size={16} />
-                </button>
+                  <p className="text-white text-sm font-medium truncate">
+                    {item.shortUrl}
+                  </p>
+                  {preview?.health === 'broken' && (
+                    <p
+                      className="text-red-300 text-xs mt-1 flex items-center"
+                      title={preview.error || `Destination answered ${preview.status_code}`}
+                    >
+                      <AlertTriangle size={12} className="mr-1 flex-shrink-0" />
+                      Broken link
+                    </p>
+                  )}
+                  {preview?.title && (
+                    <p className="text-white text-xs font-medium truncate mt-1 flex items-center">
+                      {preview.favicon_url && (
+                        <img
+                          src={preview.favicon_url}
+                          alt=""
+                          className="w-4 h-4 mr-2 flex-shrink-0"
+                          referrerPolicy="no-referrer"
+                          onError={(e) => { e.currentTarget.style.display = 'none'; }}
+                        />
+                      )}
+                      {preview.title}
+                    </p>
+                  )}
+                  {preview?.description && (
+                    <p className="text-purple-200 text-xs mt-1 line-clamp-2">
+                      {preview.description}
+                    </p>
+                  )}
+                  <p className="text-purple-200 text-xs truncate mt-1">
+                    {item.originalUrl}
+                  </p>
+                  <p className="text-purple-300 text-xs mt-2 opacity-80">
+                    {formatDate(item.createdAt)}
+                  </p>
+                </div>
+                {preview?.image_url && (
+                  <img
+                    src={preview.image_url}
+                    alt=""
+                    className="w-16 h-16 object-cover rounded mr-2 flex-shrink-0"
+                    loading="lazy"
+                    referrerPolicy="no-referrer"
+                    onError={(e) => { e.currentTarget.style.display = 'none'; }}
+                  />
+                )}
+                <div className="flex space-x-2">
+                  <button 
+                    className="text-purple-200 hover:text-white transition-colors p-1 rounded"
+                    onClick={() => window.open(item.shortUrl, '_blank')}
+                    title="Open shortened URL"
+                  >
+                    <ExternalLink size={16} />
+                  </button>
+                  <button 
+                    className="text-purple-200 hover:text-red-300 transition-colors p-1 rounded"
+                    onClick={() => onRemoveItem(item.id)}
+                    title="Remove from history"
+                  >
+                    <Trash2 size={16} />
+                  </button>
+                </div>
               </div>
             </div>
-          </div>
-        ))}
+          );
+        })}
       </div>
     </div>
   );
@@ -1,4 +1,5 @@
 import { useState, useEffect } from 'react';
+import { LinkMetadata } from '../types';
 
 // API URL - can be overridden with environment variables
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:8080';
@@ -8,6 +9,9 @@ export interface UserUrl {
   short_url: string;
   original_url: string;
   created_at: string;
+  expires_at?: string;
+  clicks_remaining?: number;
+  metadata?: LinkMetadata;
 }
 
 export const useUserUrls = () => {
@@ -11,4 +11,22 @@ export interface FormState {
   error: string;
   aliasError?: string;
   isSubmitting: boolean;
-}
\ No newline at end of file
+}
+
+// Result of the backend's last check of a link's destination
+export interface LinkMetadata {
+  checked_at: string;
+  status: 'ok' | 'failed' | 'blocked';
+  status_code?: number;
+  content_type?: string;
+  title?: string;
+  description?: string;
+  image_url?: string;
+  favicon_url?: string;
+  error?: string;
+  // Judged over consecutive rechecks of the destination
+  health?: 'healthy' | 'broken';
+  health_since?: string;
+  failures?: number;
+  next_check_at?: string;
+}